@@ -1,12 +1,47 @@
 package main
 
 import (
+	"os"
+
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/nomad/plugins"
+	"github.com/shoenig/nomad-pledge/pkg/holder"
+	"github.com/shoenig/nomad-pledge/pkg/landlock"
+	"github.com/shoenig/nomad-pledge/pkg/mountns"
 	"github.com/shoenig/nomad-pledge/pkg/plugin"
+	"github.com/shoenig/nomad-pledge/pkg/reaper"
+	"github.com/shoenig/nomad-pledge/pkg/render"
+	"github.com/shoenig/nomad-pledge/pkg/run"
+	"github.com/shoenig/nomad-pledge/pkg/sandbox"
+	"github.com/shoenig/nomad-pledge/pkg/shim"
 )
 
 func main() {
+	// the plugin executable doubles as the supervisor, init, network rules
+	// stage, unveil emulation stage, and native sandbox of each task, as the
+	// holder of the namespaces shared by an allocation, and provides the run
+	// and render tools for debugging tasks locally
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case shim.Command:
+			os.Exit(shim.Run(os.Args[2:]))
+		case reaper.Command:
+			os.Exit(reaper.Run(os.Args[2:]))
+		case holder.Command:
+			os.Exit(holder.Run(os.Args[2:]))
+		case landlock.Command:
+			os.Exit(landlock.Run(os.Args[2:]))
+		case mountns.Command:
+			os.Exit(mountns.Run(os.Args[2:]))
+		case sandbox.Command:
+			os.Exit(sandbox.Run(os.Args[2:]))
+		case run.Command:
+			os.Exit(run.Run(os.Args[2:]))
+		case render.Command:
+			os.Exit(render.Run(os.Args[2:]))
+		}
+	}
+
 	plugins.Serve(factory)
 }
 
@@ -0,0 +1,99 @@
+package caps
+
+import (
+	"fmt"
+	"strings"
+)
+
+// names of the Linux capabilities, indexed by capability number.
+//
+// See `man 7 capabilities`.
+var names = []string{
+	"chown",              // 0
+	"dac_override",       // 1
+	"dac_read_search",    // 2
+	"fowner",             // 3
+	"fsetid",             // 4
+	"kill",               // 5
+	"setgid",             // 6
+	"setuid",             // 7
+	"setpcap",            // 8
+	"linux_immutable",    // 9
+	"net_bind_service",   // 10
+	"net_broadcast",      // 11
+	"net_admin",          // 12
+	"net_raw",            // 13
+	"ipc_lock",           // 14
+	"ipc_owner",          // 15
+	"sys_module",         // 16
+	"sys_rawio",          // 17
+	"sys_chroot",         // 18
+	"sys_ptrace",         // 19
+	"sys_pacct",          // 20
+	"sys_admin",          // 21
+	"sys_boot",           // 22
+	"sys_nice",           // 23
+	"sys_resource",       // 24
+	"sys_time",           // 25
+	"sys_tty_config",     // 26
+	"mknod",              // 27
+	"lease",              // 28
+	"audit_write",        // 29
+	"audit_control",      // 30
+	"setfcap",            // 31
+	"mac_override",       // 32
+	"mac_admin",          // 33
+	"syslog",             // 34
+	"wake_alarm",         // 35
+	"block_suspend",      // 36
+	"audit_read",         // 37
+	"perfmon",            // 38
+	"bpf",                // 39
+	"checkpoint_restore", // 40
+}
+
+// NetBindService is the capability for binding to privileged ports.
+const NetBindService = 10
+
+// Parse returns the capability number of the named capability. The name
+// is case-insensitive and the "cap_" prefix is optional.
+func Parse(name string) (int, error) {
+	normal := strings.TrimPrefix(strings.ToLower(name), "cap_")
+	for i, n := range names {
+		if n == normal {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("capability %q not recognized", name)
+}
+
+// Name returns the canonical name of capability c, e.g. "cap_net_bind_service".
+func Name(c int) string {
+	if c < 0 || c >= len(names) {
+		return fmt.Sprintf("cap_%d", c)
+	}
+	return "cap_" + names[c]
+}
+
+// Set is a bitmask of capabilities.
+type Set uint64
+
+// Contains returns whether capability c is a member of s.
+func (s Set) Contains(c int) bool {
+	return s&(1<<uint(c)) != 0
+}
+
+// Names returns the canonical names of the capabilities in s.
+func (s Set) Names() []string {
+	var result []string
+	for c := 0; c < 64; c++ {
+		if s.Contains(c) {
+			result = append(result, Name(c))
+		}
+	}
+	return result
+}
+
+func (s Set) String() string {
+	return strings.Join(s.Names(), ",")
+}
@@ -0,0 +1,87 @@
+package caps
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// xattr is the extended attribute in which file capabilities are stored.
+const xattr = "security.capability"
+
+const (
+	revisionMask  = 0xff000000
+	revision1     = 0x01000000
+	revision2     = 0x02000000
+	revision3     = 0x03000000
+	flagEffective = 0x000001
+)
+
+// File represents the capabilities set on an executable file.
+//
+// See `man 7 capabilities`, section "File capabilities".
+type File struct {
+	Permitted   Set
+	Inheritable Set
+	Effective   Set
+}
+
+// FromFile reads and decodes the capabilities set on the file at path. A file
+// without any capabilities set results in an empty File.
+func FromFile(path string) (*File, error) {
+	buf := make([]byte, 64)
+	n, err := unix.Getxattr(path, xattr, buf)
+	switch {
+	case errors.Is(err, unix.ENODATA):
+		return new(File), nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read capabilities of %q: %w", path, err)
+	}
+	return Decode(buf[:n])
+}
+
+// Decode the content of a security.capability extended attribute, which is
+// the little-endian encoding of the kernel vfs_cap_data structure.
+func Decode(b []byte) (*File, error) {
+	if len(b) < 4 {
+		return nil, errors.New("capability data too short")
+	}
+
+	magic := binary.LittleEndian.Uint32(b[0:4])
+
+	var words int
+	switch magic & revisionMask {
+	case revision1:
+		words = 1
+	case revision2, revision3:
+		words = 2
+	default:
+		return nil, fmt.Errorf("capability revision %#x not supported", magic&revisionMask)
+	}
+
+	if len(b) < 4+words*8 {
+		return nil, errors.New("capability data too short")
+	}
+
+	var permitted, inheritable uint64
+	for i := 0; i < words; i++ {
+		offset := 4 + i*8
+		permitted |= uint64(binary.LittleEndian.Uint32(b[offset:])) << (32 * i)
+		inheritable |= uint64(binary.LittleEndian.Uint32(b[offset+4:])) << (32 * i)
+	}
+
+	f := &File{
+		Permitted:   Set(permitted),
+		Inheritable: Set(inheritable),
+	}
+
+	// the effective bit on a file means all the permitted and inheritable
+	// capabilities are raised into the effective set upon exec
+	if magic&flagEffective != 0 {
+		f.Effective = f.Permitted | f.Inheritable
+	}
+
+	return f, nil
+}
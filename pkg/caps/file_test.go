@@ -0,0 +1,62 @@
+package caps
+
+import (
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestFile_Decode(t *testing.T) {
+	// output of setcap cap_net_bind_service+eip
+	b := []byte{
+		0x01, 0x00, 0x00, 0x02, // revision 2, effective
+		0x00, 0x04, 0x00, 0x00, // permitted[0]
+		0x00, 0x04, 0x00, 0x00, // inheritable[0]
+		0x00, 0x00, 0x00, 0x00, // permitted[1]
+		0x00, 0x00, 0x00, 0x00, // inheritable[1]
+	}
+
+	f, err := Decode(b)
+	must.NoError(t, err)
+	must.True(t, f.Permitted.Contains(NetBindService))
+	must.True(t, f.Inheritable.Contains(NetBindService))
+	must.True(t, f.Effective.Contains(NetBindService))
+	must.Eq(t, "cap_net_bind_service", f.Effective.String())
+}
+
+func TestFile_Decode_notEffective(t *testing.T) {
+	// output of setcap cap_net_raw,cap_checkpoint_restore+p
+	b := []byte{
+		0x00, 0x00, 0x00, 0x02, // revision 2
+		0x00, 0x20, 0x00, 0x00, // permitted[0]
+		0x00, 0x00, 0x00, 0x00, // inheritable[0]
+		0x00, 0x01, 0x00, 0x00, // permitted[1]
+		0x00, 0x00, 0x00, 0x00, // inheritable[1]
+	}
+
+	f, err := Decode(b)
+	must.NoError(t, err)
+	must.Eq(t, []string{"cap_net_raw", "cap_checkpoint_restore"}, f.Permitted.Names())
+	must.Zero(t, f.Effective)
+}
+
+func TestFile_Decode_invalid(t *testing.T) {
+	_, err := Decode([]byte{0x00, 0x00})
+	must.Error(t, err)
+
+	_, err = Decode([]byte{0x00, 0x00, 0x00, 0x09})
+	must.Error(t, err)
+}
+
+func TestCapabilities_Parse(t *testing.T) {
+	c, err := Parse("CAP_NET_BIND_SERVICE")
+	must.NoError(t, err)
+	must.Eq(t, NetBindService, c)
+
+	c, err = Parse("net_bind_service")
+	must.NoError(t, err)
+	must.Eq(t, NetBindService, c)
+
+	_, err = Parse("net_bind")
+	must.Error(t, err)
+}
@@ -0,0 +1,135 @@
+// Package holder implements the process holding the namespaces shared by the
+// tasks of an allocation.
+//
+// The holder is the plugin executable re-invoked with the Command argument, one
+// per allocation with tasks sharing their pid or ipc namespace. It is cloned
+// into new pid and ipc namespaces, runs as PID 1 of the pid namespace, and does
+// nothing but reap orphaned processes. Tasks join the namespaces of the holder
+// rather than those of another task, so that the exit of one task does not
+// kill every other process in the pid namespace. The holder runs as nobody and
+// ignores every signal, so it can only be stopped by SIGKILL from outside of
+// its pid namespace.
+package holder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/shoenig/nomad-pledge/pkg/resources/process"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Command is the argument that makes the plugin executable run as the
+	// holder of the namespaces shared by an allocation.
+	Command = "hold"
+
+	// readyFD is the file descriptor over which the holder reports that it
+	// ignores signals, after which it is safe for tasks to join.
+	readyFD = 3
+
+	// nobody is the uid and gid the holder runs as
+	nobody = 65534
+
+	// readyTimeout is how long to wait for the holder to become ready
+	readyTimeout = 5 * time.Second
+)
+
+// Start a holder with the plugin executable self, returning the host pid of
+// the holder once it is ready to be joined. The holder runs in a session of its
+// own, so it survives restarts of the plugin.
+func Start(self string) (int, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	cmd := exec.Command(self, Command)
+	cmd.Dir = "/"
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:     true,
+		Cloneflags: syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC,
+		Credential: &syscall.Credential{Uid: nobody, Gid: nobody},
+	}
+	err = cmd.Start()
+	_ = w.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start holder: %w", err)
+	}
+
+	// reap the holder if it exits while the plugin is running
+	go func() { _ = cmd.Wait() }()
+
+	ready := make(chan error, 1)
+	go func() {
+		_, rErr := io.ReadFull(r, make([]byte, 1))
+		ready <- rErr
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(readyTimeout):
+		err = errors.New("timeout")
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return 0, fmt.Errorf("holder did not become ready: %w", err)
+	}
+	return cmd.Process.Pid, nil
+}
+
+// Is returns whether pid is a holder started with the plugin executable self.
+func Is(self string, pid int) bool {
+	args := process.Cmdline(pid)
+	return len(args) > 1 && args[0] == self && args[1] == Command
+}
+
+// Stop the holder with pid started with the plugin executable self, killing
+// every process remaining in its pid namespace.
+func Stop(self string, pid int) error {
+	if !Is(self, pid) {
+		return nil
+	}
+	return unix.Kill(pid, unix.SIGKILL)
+}
+
+// Run the holder, which never returns unless reporting readiness fails.
+func Run(_ []string) int {
+	// as PID 1, only signals with a handler are delivered from within the pid
+	// namespace, so ignoring them keeps tasks from stopping the holder
+	signal.Ignore()
+	children := make(chan os.Signal, 64)
+	signal.Notify(children, unix.SIGCHLD)
+
+	ready := os.NewFile(readyFD, "ready")
+	if _, err := ready.Write([]byte{1}); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge hold: failed to report ready: %v\n", err)
+		return 1
+	}
+	_ = ready.Close()
+
+	for range children {
+		reap()
+	}
+	return 0
+}
+
+// reap every exited child.
+func reap() {
+	for {
+		wpid, err := unix.Wait4(-1, nil, unix.WNOHANG, nil)
+		switch {
+		case errors.Is(err, unix.EINTR):
+			continue
+		case err != nil || wpid <= 0:
+			return
+		}
+	}
+}
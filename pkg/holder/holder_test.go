@@ -0,0 +1,62 @@
+package holder
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shoenig/test/must"
+	"github.com/shoenig/test/wait"
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary doubles as the holder
+	if len(os.Args) > 1 && os.Args[1] == Command {
+		os.Exit(Run(os.Args[2:]))
+	}
+	os.Exit(m.Run())
+}
+
+func TestHolder(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	// the holder runs as nobody, which must be able to execute it
+	self := filepath.Join(t.TempDir(), "plugin")
+	b, err := os.ReadFile(os.Args[0])
+	must.NoError(t, err)
+	must.NoError(t, os.WriteFile(self, b, 0o755))
+	dir := filepath.Dir(self)
+	must.NoError(t, os.Chmod(dir, 0o755))
+	must.NoError(t, os.Chmod(filepath.Dir(dir), 0o755))
+
+	pid, err := Start(self)
+	must.NoError(t, err)
+	must.True(t, Is(self, pid))
+	must.False(t, Is("/other/plugin", pid))
+
+	// the holder has namespaces of its own
+	for _, ns := range []string{"pid", "ipc"} {
+		own, oErr := os.Readlink(filepath.Join("/proc/self/ns", ns))
+		must.NoError(t, oErr)
+		held, hErr := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "ns", ns))
+		must.NoError(t, hErr)
+		must.NotEq(t, own, held)
+	}
+
+	// signals other than SIGKILL are ignored
+	must.NoError(t, unix.Kill(pid, unix.SIGTERM))
+	time.Sleep(100 * time.Millisecond)
+	must.True(t, Is(self, pid))
+
+	must.NoError(t, Stop(self, pid))
+	must.Wait(t, wait.InitialSuccess(
+		wait.BoolFunc(func() bool { return !Is(self, pid) }),
+		wait.Timeout(5*time.Second),
+		wait.Gap(10*time.Millisecond),
+	))
+}
@@ -0,0 +1,119 @@
+package ids
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrExhausted is returned when every block of a Pool is in use.
+var ErrExhausted = errors.New("no ids remaining in pool")
+
+// Pool allocates blocks of contiguous ids (e.g. uids and gids) to owners
+// (e.g. tasks) from a fixed range of ids.
+type Pool interface {
+	// Acquire the first free block of ids for owner, returning the first id
+	// of the block. If owner already holds a block, that block is returned.
+	Acquire(owner string) (uint32, error)
+
+	// Claim the block of ids beginning at base for owner, e.g. when
+	// recovering the state of a task.
+	Claim(owner string, base uint32) error
+
+	// Release the block of ids held by owner, if any.
+	Release(owner string)
+
+	// Peek returns the first id of the first free block for which usable
+	// returns true, without acquiring it.
+	Peek(usable func(base uint32) bool) (uint32, error)
+}
+
+// NewPool creates a Pool of count blocks of size ids, starting at start.
+func NewPool(start, size, count uint32) Pool {
+	return &pool{
+		start:  start,
+		size:   size,
+		count:  count,
+		owners: make(map[string]uint32),
+		blocks: make(map[uint32]string),
+	}
+}
+
+type pool struct {
+	lock sync.Mutex
+
+	start uint32
+	size  uint32
+	count uint32
+
+	owners map[string]uint32 // owner -> block index
+	blocks map[uint32]string // block index -> owner
+}
+
+func (p *pool) base(block uint32) uint32 {
+	return p.start + block*p.size
+}
+
+func (p *pool) Acquire(owner string) (uint32, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if block, exists := p.owners[owner]; exists {
+		return p.base(block), nil
+	}
+
+	for block := uint32(0); block < p.count; block++ {
+		if _, used := p.blocks[block]; !used {
+			p.owners[owner] = block
+			p.blocks[block] = owner
+			return p.base(block), nil
+		}
+	}
+
+	return 0, ErrExhausted
+}
+
+func (p *pool) Peek(usable func(base uint32) bool) (uint32, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for block := uint32(0); block < p.count; block++ {
+		if _, used := p.blocks[block]; !used && usable(p.base(block)) {
+			return p.base(block), nil
+		}
+	}
+
+	return 0, ErrExhausted
+}
+
+func (p *pool) Claim(owner string, base uint32) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if base < p.start || (base-p.start)%p.size != 0 {
+		return fmt.Errorf("id %d is not the beginning of a block", base)
+	}
+
+	block := (base - p.start) / p.size
+	if block >= p.count {
+		return fmt.Errorf("id %d is outside of pool", base)
+	}
+
+	if existing, used := p.blocks[block]; used && existing != owner {
+		return fmt.Errorf("id %d is already in use", base)
+	}
+
+	p.owners[owner] = block
+	p.blocks[block] = owner
+	return nil
+}
+
+func (p *pool) Release(owner string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if block, exists := p.owners[owner]; exists {
+		delete(p.owners, owner)
+		delete(p.blocks, block)
+	}
+}
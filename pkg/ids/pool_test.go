@@ -0,0 +1,69 @@
+package ids
+
+import (
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestPool_Acquire(t *testing.T) {
+	p := NewPool(100000, 1000, 2)
+
+	a, err := p.Acquire("a")
+	must.NoError(t, err)
+	must.Eq(t, 100000, a)
+
+	b, err := p.Acquire("b")
+	must.NoError(t, err)
+	must.Eq(t, 101000, b)
+
+	// same owner gets same block
+	a2, err := p.Acquire("a")
+	must.NoError(t, err)
+	must.Eq(t, a, a2)
+
+	// pool is exhausted
+	_, err = p.Acquire("c")
+	must.ErrorIs(t, err, ErrExhausted)
+
+	// released block is reused
+	p.Release("a")
+	c, err := p.Acquire("c")
+	must.NoError(t, err)
+	must.Eq(t, 100000, c)
+}
+
+func TestPool_Claim(t *testing.T) {
+	p := NewPool(100000, 1000, 2)
+
+	must.NoError(t, p.Claim("a", 101000))
+	must.Error(t, p.Claim("b", 101000))
+	must.Error(t, p.Claim("b", 101001))
+	must.Error(t, p.Claim("b", 102000))
+	must.Error(t, p.Claim("b", 99000))
+
+	b, err := p.Acquire("b")
+	must.NoError(t, err)
+	must.Eq(t, 100000, b)
+}
+
+func TestPool_Peek(t *testing.T) {
+	p := NewPool(100000, 1000, 3)
+	all := func(uint32) bool { return true }
+
+	// peeking does not acquire the block
+	base, err := p.Peek(all)
+	must.NoError(t, err)
+	must.Eq(t, 100000, base)
+	a, err := p.Acquire("a")
+	must.NoError(t, err)
+	must.Eq(t, base, a)
+
+	// unusable blocks are skipped
+	base, err = p.Peek(func(b uint32) bool { return b != 101000 })
+	must.NoError(t, err)
+	must.Eq(t, 102000, base)
+
+	_, err = p.Peek(func(uint32) bool { return false })
+	must.ErrorIs(t, err, ErrExhausted)
+}
@@ -0,0 +1,65 @@
+package ids
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Range of ids from First to Last inclusive.
+type Range struct {
+	First uint32
+	Last  uint32
+}
+
+// Ranges is a set of ids described by a list of ranges.
+type Ranges []Range
+
+// ParseRanges parses a comma separated list of ids and inclusive ranges of ids,
+// e.g. "0,100-199".
+func ParseRanges(s string) (Ranges, error) {
+	var result Ranges
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := strconv.ParseUint(strings.TrimSpace(first), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", part)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.ParseUint(strings.TrimSpace(last), 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid id range %q", part)
+			}
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("invalid id range %q: first id exceeds last", part)
+		}
+		result = append(result, Range{First: uint32(lo), Last: uint32(hi)})
+	}
+	return result, nil
+}
+
+// Overlaps returns whether any id from first to last inclusive is in any of the
+// ranges.
+func (r Ranges) Overlaps(first, last uint32) bool {
+	for _, rng := range r {
+		if first <= rng.Last && rng.First <= last {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains returns whether id is in any of the ranges.
+func (r Ranges) Contains(id uint32) bool {
+	for _, rng := range r {
+		if id >= rng.First && id <= rng.Last {
+			return true
+		}
+	}
+	return false
+}
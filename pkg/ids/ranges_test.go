@@ -0,0 +1,56 @@
+package ids
+
+import (
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestParseRanges(t *testing.T) {
+	r, err := ParseRanges("")
+	must.NoError(t, err)
+	must.SliceEmpty(t, r)
+
+	r, err = ParseRanges("0, 100-199,65534")
+	must.NoError(t, err)
+	must.Eq(t, Ranges{{0, 0}, {100, 199}, {65534, 65534}}, r)
+
+	_, err = ParseRanges("abc")
+	must.ErrorContains(t, err, `invalid id "abc"`)
+
+	_, err = ParseRanges("10-x")
+	must.ErrorContains(t, err, `invalid id range "10-x"`)
+
+	_, err = ParseRanges("20-10")
+	must.ErrorContains(t, err, "first id exceeds last")
+
+	_, err = ParseRanges("4294967296")
+	must.Error(t, err)
+}
+
+func TestRanges_Contains(t *testing.T) {
+	r, err := ParseRanges("0,100-199")
+	must.NoError(t, err)
+
+	must.True(t, r.Contains(0))
+	must.True(t, r.Contains(100))
+	must.True(t, r.Contains(150))
+	must.True(t, r.Contains(199))
+	must.False(t, r.Contains(1))
+	must.False(t, r.Contains(200))
+	must.False(t, Ranges(nil).Contains(0))
+}
+
+func TestRanges_Overlaps(t *testing.T) {
+	r, err := ParseRanges("0,100-199")
+	must.NoError(t, err)
+
+	must.True(t, r.Overlaps(0, 10))
+	must.True(t, r.Overlaps(50, 100))
+	must.True(t, r.Overlaps(120, 130))
+	must.True(t, r.Overlaps(199, 300))
+	must.True(t, r.Overlaps(50, 300))
+	must.False(t, r.Overlaps(1, 99))
+	must.False(t, r.Overlaps(200, 300))
+	must.False(t, Ranges(nil).Overlaps(0, 10))
+}
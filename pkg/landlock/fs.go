@@ -0,0 +1,190 @@
+package landlock
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// from linux/landlock.h
+const (
+	rulePathBeneath = 1
+
+	accessExecute    = 1 << 0
+	accessWriteFile  = 1 << 1
+	accessReadFile   = 1 << 2
+	accessReadDir    = 1 << 3
+	accessRemoveDir  = 1 << 4
+	accessRemoveFile = 1 << 5
+	accessMakeChar   = 1 << 6
+	accessMakeDir    = 1 << 7
+	accessMakeReg    = 1 << 8
+	accessMakeSock   = 1 << 9
+	accessMakeFifo   = 1 << 10
+	accessMakeBlock  = 1 << 11
+	accessMakeSym    = 1 << 12
+	accessRefer      = 1 << 13 // abi 2
+	accessTruncate   = 1 << 14 // abi 3
+
+	// rights that apply to files, rather than directories
+	accessFile = accessExecute | accessWriteFile | accessReadFile | accessTruncate
+)
+
+// pathBeneathAttr is struct landlock_path_beneath_attr, which is packed; the
+// kernel reads only the first 12 bytes
+type pathBeneathAttr struct {
+	allowedAccess uint64
+	parentFD      int32
+}
+
+// handledFS returns the filesystem rights known to the landlock abi.
+func handledFS(abi int) uint64 {
+	rights := uint64(accessRefer - 1)
+	if abi >= 2 {
+		rights |= accessRefer
+	}
+	if abi >= 3 {
+		rights |= accessTruncate
+	}
+	return rights
+}
+
+// permissions maps each unveil permission to the landlock rights it grants,
+// using the same meaning as the pledge utility
+var permissions = map[rune]uint64{
+	'r': accessReadFile | accessReadDir,
+	'w': accessWriteFile | accessTruncate,
+	'x': accessExecute,
+	'c': accessMakeChar | accessMakeDir | accessMakeReg | accessMakeSock |
+		accessMakeFifo | accessMakeBlock | accessMakeSym | accessRemoveDir |
+		accessRemoveFile | accessRefer,
+}
+
+// Path is a filesystem path and the rights granted beneath it.
+type Path struct {
+	Path   string
+	Access uint64
+}
+
+// Writable returns whether any right beyond reading and executing is granted
+// beneath the path.
+func (p Path) Writable() bool {
+	return p.Access&^(permissions['r']|permissions['x']) != 0
+}
+
+// Executable returns whether executing files is granted beneath the path.
+func (p Path) Executable() bool {
+	return p.Access&permissions['x'] != 0
+}
+
+// ParseUnveil parses an unveil rule of the form "[perms:]path", where perms
+// is any combination of r (read), w (write), x (execute), and c (create or
+// remove). The permission defaults to r.
+func ParseUnveil(s string) (Path, error) {
+	perms, path := "r", s
+	if i := strings.Index(s, ":"); i >= 0 && !strings.HasPrefix(s, "/") {
+		perms, path = s[:i], s[i+1:]
+	}
+	if path == "" {
+		return Path{}, fmt.Errorf("unveil %q must have a path", s)
+	}
+	var access uint64
+	for _, p := range perms {
+		rights, exists := permissions[p]
+		if !exists {
+			return Path{}, fmt.Errorf("unveil %q has unknown permission %q", s, p)
+		}
+		access |= rights
+	}
+	return Path{Path: path, Access: access}, nil
+}
+
+// RestrictPaths restricts the calling thread, and any process it executes, to
+// accessing only the given paths, with the rights granted beneath each. Rights
+// unknown to the landlock abi of the kernel are ignored.
+func RestrictPaths(paths []Path) error {
+	abi, err := ABI()
+	if err != nil {
+		return fmt.Errorf("landlock not supported: %w", err)
+	}
+	handled := handledFS(abi)
+
+	// older kernels accept the larger attr, as long as the rest is zero
+	attr := rulesetAttr{handledAccessFS: handled}
+	fd, _, errno := unix.Syscall(
+		unix.SYS_LANDLOCK_CREATE_RULESET,
+		uintptr(unsafe.Pointer(&attr)),
+		unsafe.Sizeof(attr),
+		0,
+	)
+	if errno != 0 {
+		return fmt.Errorf("failed to create landlock ruleset: %w", errno)
+	}
+	defer func() { _ = unix.Close(int(fd)) }()
+
+	for _, p := range paths {
+		if err = addPath(int(fd), p, handled); err != nil {
+			return err
+		}
+	}
+
+	return restrictSelf(fd)
+}
+
+func addPath(ruleset int, p Path, handled uint64) error {
+	parent, err := unix.Open(p.Path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open unveil path %q: %w", p.Path, err)
+	}
+	defer func() { _ = unix.Close(parent) }()
+
+	var st unix.Stat_t
+	if err = unix.Fstat(parent, &st); err != nil {
+		return fmt.Errorf("failed to stat unveil path %q: %w", p.Path, err)
+	}
+
+	// directory rights cannot be granted on files
+	access := p.Access & handled
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= accessFile
+	}
+	if access == 0 {
+		return nil
+	}
+
+	rule := pathBeneathAttr{allowedAccess: access, parentFD: int32(parent)}
+	_, _, errno := unix.Syscall6(
+		unix.SYS_LANDLOCK_ADD_RULE,
+		uintptr(ruleset),
+		rulePathBeneath,
+		uintptr(unsafe.Pointer(&rule)),
+		0, 0, 0,
+	)
+	if errno != 0 {
+		return fmt.Errorf("failed to add landlock rule for path %q: %w", p.Path, errno)
+	}
+	return nil
+}
+
+// restrictSelf enforces the ruleset, which requires either CAP_SYS_ADMIN or
+// no_new_privs.
+func restrictSelf(fd uintptr) error {
+	restrict := func() syscall.Errno {
+		_, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, fd, 0, 0)
+		return errno
+	}
+	errno := restrict()
+	if errno == unix.EPERM {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to set no_new_privs: %w", err)
+		}
+		errno = restrict()
+	}
+	if errno != 0 {
+		return fmt.Errorf("failed to enforce landlock ruleset: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package landlock
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestFS_ParseUnveil(t *testing.T) {
+	p, err := ParseUnveil("/etc")
+	must.NoError(t, err)
+	must.Eq(t, Path{Path: "/etc", Access: accessReadFile | accessReadDir}, p)
+
+	p, err = ParseUnveil("rx:/usr/bin")
+	must.NoError(t, err)
+	must.Eq(t, Path{Path: "/usr/bin", Access: accessReadFile | accessReadDir | accessExecute}, p)
+
+	p, err = ParseUnveil("wc:/tmp")
+	must.NoError(t, err)
+	must.Eq(t, uint64(0), p.Access&accessReadFile)
+	must.Eq(t, uint64(accessMakeReg), p.Access&accessMakeReg)
+
+	_, err = ParseUnveil("rz:/tmp")
+	must.EqError(t, err, `unveil "rz:/tmp" has unknown permission 'z'`)
+
+	_, err = ParseUnveil("r:")
+	must.EqError(t, err, `unveil "r:" must have a path`)
+}
+
+func TestFS_handledFS(t *testing.T) {
+	must.Eq(t, uint64(1<<13-1), handledFS(1))
+	must.Eq(t, uint64(1<<14-1), handledFS(2))
+	must.Eq(t, uint64(1<<15-1), handledFS(3))
+	must.Eq(t, uint64(1<<15-1), handledFS(5))
+}
+
+func TestFS_RestrictPaths(t *testing.T) {
+	if _, err := ABI(); err != nil {
+		t.Skip("landlock not supported")
+	}
+
+	allowed, denied := t.TempDir(), t.TempDir()
+	for _, dir := range []string{allowed, denied} {
+		must.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte("x"), 0o644))
+	}
+
+	result := make(chan [2]error)
+	go func() {
+		// the restricted thread is discarded when the goroutine exits
+		runtime.LockOSThread()
+		if err := RestrictPaths([]Path{{Path: allowed, Access: accessReadFile | accessReadDir}}); err != nil {
+			result <- [2]error{err, err}
+			return
+		}
+		_, aErr := os.ReadFile(filepath.Join(allowed, "file"))
+		_, dErr := os.ReadFile(filepath.Join(denied, "file"))
+		result <- [2]error{aErr, dErr}
+	}()
+
+	errs := <-result
+	must.NoError(t, errs[0])
+	must.ErrorIs(t, errs[1], syscall.EACCES)
+}
+
+func TestPath_Writable(t *testing.T) {
+	for unveil, writable := range map[string]bool{
+		"/etc":     false,
+		"rx:/usr":  false,
+		"w:/var":   true,
+		"c:/var":   true,
+		"rwc:/tmp": true,
+	} {
+		p, err := ParseUnveil(unveil)
+		must.NoError(t, err)
+		must.Eq(t, writable, p.Writable(), must.Sprint(unveil))
+	}
+}
+
+func TestPath_Executable(t *testing.T) {
+	for unveil, executable := range map[string]bool{
+		"/etc":     false,
+		"rx:/usr":  true,
+		"x:/opt":   true,
+		"rwc:/tmp": false,
+	} {
+		p, err := ParseUnveil(unveil)
+		must.NoError(t, err)
+		must.Eq(t, executable, p.Executable(), must.Sprint(unveil))
+	}
+}
@@ -0,0 +1,20 @@
+package landlock
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// ABI returns the version of the Landlock ABI supported by the running kernel,
+// or an error if Landlock is not supported or has been disabled.
+func ABI() (int, error) {
+	v, _, errno := unix.Syscall(
+		unix.SYS_LANDLOCK_CREATE_RULESET,
+		0,
+		0,
+		unix.LANDLOCK_CREATE_RULESET_VERSION,
+	)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(v), nil
+}
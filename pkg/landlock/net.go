@@ -0,0 +1,195 @@
+package landlock
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Command is the argument that makes the plugin executable apply the
+	// Landlock network rules of a task before executing the rest of the
+	// sandbox.
+	Command = "landlock"
+
+	// NetABI is the first Landlock ABI able to restrict TCP ports.
+	NetABI = 4
+)
+
+// from linux/landlock.h
+const (
+	ruleNetPort   = 2
+	accessBindTCP = 1 << 0
+	accessConnTCP = 1 << 1
+)
+
+// rulesetAttr is struct landlock_ruleset_attr, as of ABI 4
+type rulesetAttr struct {
+	handledAccessFS  uint64
+	handledAccessNet uint64
+}
+
+// netPortAttr is struct landlock_net_port_attr
+type netPortAttr struct {
+	allowedAccess uint64
+	port          uint64
+}
+
+// Ports are the TCP ports a task may bind and connect to. A nil list leaves
+// that access unrestricted, while an empty list denies every port.
+type Ports struct {
+	Bind    []int
+	Connect []int
+}
+
+// Arguments returns the arguments for running the network rules stage with
+// ports, followed by the given command, excluding the executable.
+func Arguments(ports *Ports, args []string) []string {
+	result := []string{Command}
+	if ports.Bind != nil {
+		result = append(result, "-bind", join(ports.Bind))
+	}
+	if ports.Connect != nil {
+		result = append(result, "-connect", join(ports.Connect))
+	}
+	result = append(result, "--")
+	return append(result, args...)
+}
+
+func join(ports []int) string {
+	list := make([]string, 0, len(ports))
+	for _, port := range ports {
+		list = append(list, strconv.Itoa(port))
+	}
+	return strings.Join(list, ",")
+}
+
+func split(s string) ([]int, error) {
+	result := []int{}
+	if s == "" {
+		return result, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", field)
+		}
+		result = append(result, port)
+	}
+	return result, nil
+}
+
+// Run the network rules stage with the given arguments, excluding the
+// executable and Command. On success Run does not return, because the process
+// is replaced by the command.
+func Run(args []string) int {
+	ports := new(Ports)
+	flags := flag.NewFlagSet(Command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Func("bind", "ports allowed to bind", func(s string) (err error) {
+		ports.Bind, err = split(s)
+		return err
+	})
+	flags.Func("connect", "ports allowed to connect", func(s string) (err error) {
+		ports.Connect, err = split(s)
+		return err
+	})
+
+	err := flags.Parse(args)
+	if err == nil && flags.NArg() == 0 {
+		err = errors.New("command must be set")
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge landlock: %v\n", err)
+		return 1
+	}
+
+	// the ruleset applies to the calling thread, which must be the one
+	// that executes the command
+	runtime.LockOSThread()
+
+	if err = RestrictPorts(ports); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge landlock: %v\n", err)
+		return 1
+	}
+
+	command := flags.Args()
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge landlock: %v\n", err)
+		return 127
+	}
+	err = syscall.Exec(path, command, os.Environ())
+	_, _ = fmt.Fprintf(os.Stderr, "pledge landlock: failed to exec command: %v\n", err)
+	return 127
+}
+
+// RestrictPorts restricts the calling thread, and any process it executes,
+// to binding and connecting to only the given TCP ports.
+func RestrictPorts(ports *Ports) error {
+	abi, err := ABI()
+	if err != nil {
+		return fmt.Errorf("landlock not supported: %w", err)
+	}
+	if abi < NetABI {
+		return fmt.Errorf("landlock abi %d does not support network rules, need %d", abi, NetABI)
+	}
+
+	attr := rulesetAttr{}
+	if ports.Bind != nil {
+		attr.handledAccessNet |= accessBindTCP
+	}
+	if ports.Connect != nil {
+		attr.handledAccessNet |= accessConnTCP
+	}
+	if attr.handledAccessNet == 0 {
+		return nil
+	}
+	fd, _, errno := unix.Syscall(
+		unix.SYS_LANDLOCK_CREATE_RULESET,
+		uintptr(unsafe.Pointer(&attr)),
+		unsafe.Sizeof(attr),
+		0,
+	)
+	if errno != 0 {
+		return fmt.Errorf("failed to create landlock ruleset: %w", errno)
+	}
+	defer func() { _ = unix.Close(int(fd)) }()
+
+	add := func(access uint64, port int) error {
+		rule := netPortAttr{allowedAccess: access, port: uint64(port)}
+		_, _, errno := unix.Syscall6(
+			unix.SYS_LANDLOCK_ADD_RULE,
+			fd,
+			ruleNetPort,
+			uintptr(unsafe.Pointer(&rule)),
+			0, 0, 0,
+		)
+		if errno != 0 {
+			return fmt.Errorf("failed to add landlock rule for port %d: %w", port, errno)
+		}
+		return nil
+	}
+	for _, port := range ports.Bind {
+		if err = add(accessBindTCP, port); err != nil {
+			return err
+		}
+	}
+	for _, port := range ports.Connect {
+		if err = add(accessConnTCP, port); err != nil {
+			return err
+		}
+	}
+
+	return restrictSelf(fd)
+}
@@ -0,0 +1,74 @@
+package landlock
+
+import (
+	"net"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestNet_Arguments(t *testing.T) {
+	args := Arguments(&Ports{Bind: []int{8080}, Connect: []int{443, 5432}}, []string{"echo"})
+	must.Eq(t, []string{"landlock", "-bind", "8080", "-connect", "443,5432", "--", "echo"}, args)
+
+	// connect is unrestricted, and every bind is denied
+	args = Arguments(&Ports{Bind: []int{}}, []string{"echo"})
+	must.Eq(t, []string{"landlock", "-bind", "", "--", "echo"}, args)
+}
+
+func TestNet_split(t *testing.T) {
+	ports, err := split("443,5432")
+	must.NoError(t, err)
+	must.Eq(t, []int{443, 5432}, ports)
+
+	ports, err = split("")
+	must.NoError(t, err)
+	must.NotNil(t, ports)
+	must.SliceEmpty(t, ports)
+
+	_, err = split("443,https")
+	must.EqError(t, err, `invalid port "https"`)
+}
+
+func TestNet_RestrictPorts(t *testing.T) {
+	if abi, err := ABI(); err != nil || abi < NetABI {
+		t.Skip("landlock network rules not supported")
+	}
+
+	allowed, denied := free(t), free(t)
+
+	result := make(chan [2]error)
+	go func() {
+		// the restricted thread is discarded when the goroutine exits
+		runtime.LockOSThread()
+		if err := RestrictPorts(&Ports{Bind: []int{allowed}}); err != nil {
+			result <- [2]error{err, err}
+			return
+		}
+		result <- [2]error{bind(allowed), bind(denied)}
+	}()
+
+	errs := <-result
+	must.NoError(t, errs[0])
+	must.ErrorIs(t, errs[1], syscall.EACCES)
+}
+
+// free returns a tcp port that is not in use
+func free(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	must.NoError(t, err)
+	defer func() { _ = l.Close() }()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// bind a tcp socket to port, on the calling thread
+func bind(port int) error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = syscall.Close(fd) }()
+	return syscall.Bind(fd, &syscall.SockaddrInet4{Port: port, Addr: [4]byte{127, 0, 0, 1}})
+}
@@ -0,0 +1,285 @@
+// Package mountns emulates unveil with a mount namespace, for kernels without
+// Landlock.
+//
+// The stage is the plugin executable re-invoked with the Command argument,
+// and runs inside the mount namespace of a task, before privileges are
+// dropped. It replaces the root filesystem with a tmpfs into which only the
+// unveiled paths are bind mounted, read-only unless written or created
+// beneath and without exec unless executed beneath, and then executes the rest
+// of the sandbox.
+package mountns
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"syscall"
+
+	"github.com/shoenig/nomad-pledge/pkg/landlock"
+	"github.com/shoenig/nomad-pledge/pkg/sandbox"
+	"golang.org/x/sys/unix"
+)
+
+// Command is the argument that makes the plugin executable emulate the unveil
+// rules of a task before executing the rest of the sandbox.
+const Command = "mountns"
+
+// devices are always mounted, as even the most restricted task needs them.
+// Only the standard device nodes are mounted from /dev, as device nodes can be
+// written even on a read-only mount.
+var devices = []string{
+	"rw:/dev/null",
+	"rw:/dev/zero",
+	"rw:/dev/full",
+	"rw:/dev/random",
+	"rw:/dev/urandom",
+	"rw:/dev/tty",
+	"r:/proc",
+}
+
+// links are the symbolic links of /dev to the file descriptors of the process
+var links = map[string]string{
+	"/dev/fd":     "/proc/self/fd",
+	"/dev/stdin":  "/proc/self/fd/0",
+	"/dev/stdout": "/proc/self/fd/1",
+	"/dev/stderr": "/proc/self/fd/2",
+}
+
+// Arguments returns the arguments for running the stage with the private root
+// mounted at root, the unveil rules, and the executables that must remain
+// available, followed by the given command, excluding the executable.
+func Arguments(root string, unveil, executables, args []string) []string {
+	result := []string{Command, "-root", root}
+	for _, u := range unveil {
+		result = append(result, "-v", u)
+	}
+	for _, x := range executables {
+		result = append(result, "-x", x)
+	}
+	result = append(result, "--")
+	return append(result, args...)
+}
+
+// Run the stage with the given arguments, excluding the executable and
+// Command. On success Run does not return, because the process is replaced by
+// the command.
+func Run(args []string) int {
+	var unveil, executables []string
+	flags := flag.NewFlagSet(Command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	root := flags.String("root", "", "mount point of the private root")
+	flags.Func("v", "unveil rule", func(s string) error {
+		unveil = append(unveil, s)
+		return nil
+	})
+	flags.Func("x", "executable", func(s string) error {
+		executables = append(executables, s)
+		return nil
+	})
+
+	err := flags.Parse(args)
+	switch {
+	case err != nil:
+	case *root == "":
+		err = errors.New("root must be set")
+	case flags.NArg() == 0:
+		err = errors.New("command must be set")
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge mountns: %v\n", err)
+		return 1
+	}
+
+	// the command itself must remain available too
+	command := flags.Args()
+	paths, err := mounts(unveil, append(executables, command[0]))
+	if err == nil {
+		err = isolate(*root, paths)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge mountns: %v\n", err)
+		return 1
+	}
+
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge mountns: %v\n", err)
+		return 127
+	}
+	err = syscall.Exec(path, command, os.Environ())
+	_, _ = fmt.Fprintf(os.Stderr, "pledge mountns: failed to exec command: %v\n", err)
+	return 127
+}
+
+// mounts returns the paths to bind mount into the private root, sorted so
+// that parents are mounted before the paths beneath them: the unveiled paths,
+// the devices, and the paths needed to run each executable. The rights of a
+// path listed more than once are combined.
+func mounts(unveil, executables []string) ([]landlock.Path, error) {
+	rules := append(append([]string(nil), unveil...), devices...)
+	for _, x := range executables {
+		path, err := exec.LookPath(x)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range sandbox.Executables(path) {
+			rules = append(rules, "rx:"+p)
+		}
+	}
+
+	combined := make(map[string]uint64, len(rules))
+	for _, rule := range rules {
+		p, err := landlock.ParseUnveil(rule)
+		if err != nil {
+			return nil, err
+		}
+		combined[filepath.Clean(p.Path)] |= p.Access
+	}
+
+	paths := make([]landlock.Path, 0, len(combined))
+	for path, access := range combined {
+		paths = append(paths, landlock.Path{Path: path, Access: access})
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].Path < paths[j].Path
+	})
+	return paths, nil
+}
+
+// isolate replaces the root filesystem of the mount namespace with a tmpfs
+// mounted at root, containing bind mounts of only the given paths. Paths that
+// do not exist are skipped. The working directory is kept if it is still
+// reachable, and is otherwise the new root.
+func isolate(root string, paths []landlock.Path) error {
+	wd, _ := os.Getwd()
+
+	// keep every mount from propagating back to the host
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return fmt.Errorf("failed to create private root: %w", err)
+	}
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("failed to mount private root: %w", err)
+	}
+
+	for _, p := range paths {
+		if err := bind(root, p); err != nil {
+			return err
+		}
+	}
+	for link, target := range links {
+		if err := symlink(root, link, target); err != nil {
+			return err
+		}
+	}
+
+	// nothing outside of the bind mounts may be created
+	flags := uintptr(unix.MS_REMOUNT | unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV)
+	if err := unix.Mount("", root, "", flags, ""); err != nil {
+		return fmt.Errorf("failed to remount private root: %w", err)
+	}
+
+	// pivot onto the private root, stacking the old root on top of it, and
+	// then detach the old root
+	if err := unix.Chdir(root); err != nil {
+		return fmt.Errorf("failed to enter private root: %w", err)
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("failed to pivot to private root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to detach old root: %w", err)
+	}
+
+	if wd == "" || unix.Chdir(wd) != nil {
+		return unix.Chdir("/")
+	}
+	return nil
+}
+
+// bind mounts path p beneath root, read-only unless it is writable, and
+// without exec unless it is executable.
+func bind(root string, p landlock.Path) error {
+	info, err := os.Stat(p.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to stat unveil path %q: %w", p.Path, err)
+	}
+
+	// mount points beneath other bind mounts already exist
+	target := filepath.Join(root, p.Path)
+	if _, err = os.Lstat(target); os.IsNotExist(err) {
+		if err = create(target, info.IsDir()); err != nil {
+			return fmt.Errorf("failed to create mount point for %q: %w", p.Path, err)
+		}
+	}
+
+	if err = unix.Mount(p.Path, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to bind mount %q: %w", p.Path, err)
+	}
+
+	var restrict uintptr
+	if !p.Writable() {
+		restrict |= unix.MS_RDONLY
+	}
+	if !p.Executable() {
+		restrict |= unix.MS_NOEXEC
+	}
+	if restrict == 0 {
+		return nil
+	}
+
+	// a remount must keep the flags of the original mount, which may be
+	// locked
+	var st unix.Statfs_t
+	if err = unix.Statfs(target, &st); err != nil {
+		return fmt.Errorf("failed to stat mount of %q: %w", p.Path, err)
+	}
+	locked := uintptr(st.Flags) & (unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC |
+		unix.MS_NOATIME | unix.MS_NODIRATIME | unix.MS_RELATIME)
+	flags := unix.MS_BIND | unix.MS_REMOUNT | locked | restrict
+	if err = unix.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("failed to restrict mount of %q: %w", p.Path, err)
+	}
+	return nil
+}
+
+// symlink creates the symbolic link beneath root, unless the link is already
+// mounted or its directory is not.
+func symlink(root, link, target string) error {
+	path := filepath.Join(root, link)
+	if _, err := os.Lstat(filepath.Dir(path)); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+	if err := os.Symlink(target, path); err != nil {
+		return fmt.Errorf("failed to create link %q: %w", link, err)
+	}
+	return nil
+}
+
+// create the mount point at target, a directory or an empty file.
+func create(target string, dir bool) error {
+	if dir {
+		return os.MkdirAll(target, 0o755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,68 @@
+package mountns
+
+import (
+	"os"
+	"testing"
+
+	"github.com/shoenig/nomad-pledge/pkg/landlock"
+	"github.com/shoenig/test/must"
+)
+
+func TestMountns_Arguments(t *testing.T) {
+	args := Arguments("/task/private/root", []string{"r:/etc", "rwc:/task/tmp"}, []string{"/bin/pledge"}, []string{"setpriv", "--"})
+	must.Eq(t, []string{
+		"mountns",
+		"-root", "/task/private/root",
+		"-v", "r:/etc",
+		"-v", "rwc:/task/tmp",
+		"-x", "/bin/pledge",
+		"--",
+		"setpriv", "--",
+	}, args)
+}
+
+func TestMountns_mounts(t *testing.T) {
+	self, err := os.Executable()
+	must.NoError(t, err)
+
+	paths, err := mounts([]string{"r:/etc/", "w:/etc", "rwc:/tmp"}, []string{self})
+	must.NoError(t, err)
+
+	find := func(path string) *landlock.Path {
+		for _, p := range paths {
+			if p.Path == path {
+				return &p
+			}
+		}
+		return nil
+	}
+
+	// rules of the same path are combined
+	etc := find("/etc")
+	must.NotNil(t, etc)
+	must.True(t, etc.Writable())
+
+	// devices and executables are always mounted, executables read-only
+	must.NotNil(t, find("/dev/null"))
+	must.Nil(t, find("/dev"))
+	must.NotNil(t, find("/proc"))
+	must.False(t, find("/proc").Writable())
+	exe := find(self)
+	must.NotNil(t, exe)
+	must.False(t, exe.Writable())
+	must.True(t, exe.Executable())
+
+	// paths are not executable unless unveiled with x
+	must.False(t, etc.Executable())
+
+	// parents are mounted first
+	for i := 1; i < len(paths); i++ {
+		must.Less(t, paths[i].Path, paths[i-1].Path)
+	}
+
+	_, err = mounts([]string{"z:/etc"}, nil)
+	must.ErrorContains(t, err, "unknown permission")
+
+	_, err = mounts(nil, []string{"doesnotexist"})
+	must.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package pledge
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/go-set/v2"
+)
+
+// Redacted is the value shown in place of the value of a redacted variable.
+const Redacted = "<redacted>"
+
+// useless variables are always purged from the task environment
+var useless = set.From([]string{"LS_COLORS", "XAUTHORITY", "DISPLAY", "COLORTERM", "MAIL", "TMPDIR"})
+
+// secrets are patterns of variables that are always redacted
+var secrets = []string{"*TOKEN*", "*SECRET*", "*PASSWORD*", "*PASSWD*", "*CREDENTIAL*", "*PRIVATE_KEY*"}
+
+// EnvPolicy describes which environment variables are passed through to the
+// task, and which have their values masked when being inspected. Each list
+// contains glob patterns as understood by path.Match, e.g. "CONSUL_*".
+type EnvPolicy struct {
+	Allow  []string // variables to keep (an empty list keeps everything)
+	Deny   []string // variables to purge
+	Redact []string // variables to mask
+}
+
+// Validate the patterns of the policy are well-formed.
+func (p *EnvPolicy) Validate() error {
+	for _, list := range [][]string{p.Allow, p.Deny, p.Redact} {
+		for _, pattern := range list {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid environment pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func matches(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// permitted returns whether the variable key is passed through to the task,
+// which must be the case for every policy.
+func permitted(key string, policies []*EnvPolicy) bool {
+	for _, p := range policies {
+		if len(p.Allow) > 0 && !matches(p.Allow, key) {
+			return false
+		}
+		if matches(p.Deny, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// redacted returns whether the value of variable key must be masked, which is
+// the case if any policy says so.
+func redacted(key string, policies []*EnvPolicy) bool {
+	if matches(secrets, strings.ToUpper(key)) {
+		return true
+	}
+	for _, p := range policies {
+		if matches(p.Redact, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func flatten(user, home, tmp string, env map[string]string, policies []*EnvPolicy) []string {
+	result := make([]string, 0, len(env))
+	for k, v := range env {
+		switch {
+		case k == "USER": // set correct $USER
+			result = append(result, "USER="+user)
+		case k == "HOME": // set correct $HOME
+			result = append(result, "HOME="+home)
+		case useless.Contains(k): // purge useless vars
+			continue
+		case !permitted(k, policies): // purge vars not allowed by policy
+			continue
+		case v == "":
+			result = append(result, k)
+		default:
+			result = append(result, k+"="+v)
+		}
+	}
+	result = append(result, "TMPDIR="+tmp)
+	return result
+}
+
+// masked converts the flattened environment into a map, with the values of
+// redacted variables masked.
+func masked(env []string, policies []*EnvPolicy) map[string]string {
+	result := make(map[string]string, len(env))
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		if redacted(k, policies) {
+			v = Redacted
+		}
+		result[k] = v
+	}
+	return result
+}
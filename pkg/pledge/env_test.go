@@ -0,0 +1,52 @@
+package pledge
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestEnv_flatten(t *testing.T) {
+	env := map[string]string{
+		"USER":        "root",
+		"HOME":        "/root",
+		"DISPLAY":     ":0",
+		"EMPTY":       "",
+		"NOMAD_TASK":  "web",
+		"CONSUL_HTTP": "localhost:8500",
+		"AGENT_DEBUG": "1",
+	}
+
+	policies := []*EnvPolicy{
+		{Allow: []string{"USER", "HOME", "EMPTY", "NOMAD_*", "CONSUL_*"}},
+		{Deny: []string{"CONSUL_*"}},
+	}
+
+	result := flatten("nobody", "/nonexistent", "/alloc/task/tmp", env, policies)
+	sort.Strings(result)
+	must.Eq(t, []string{
+		"EMPTY",
+		"HOME=/nonexistent",
+		"NOMAD_TASK=web",
+		"TMPDIR=/alloc/task/tmp",
+		"USER=nobody",
+	}, result)
+}
+
+func TestEnv_masked(t *testing.T) {
+	env := []string{"VAULT_TOKEN=abc", "DB_PASS=hunter2", "NOMAD_TASK=web"}
+	policies := []*EnvPolicy{{Redact: []string{"DB_*"}}}
+
+	result := masked(env, policies)
+	must.MapEq(t, map[string]string{
+		"VAULT_TOKEN": Redacted,
+		"DB_PASS":     Redacted,
+		"NOMAD_TASK":  "web",
+	}, result)
+}
+
+func TestEnvPolicy_Validate(t *testing.T) {
+	must.NoError(t, (&EnvPolicy{Allow: []string{"NOMAD_*"}}).Validate())
+	must.Error(t, (&EnvPolicy{Deny: []string{"[bad"}}).Validate())
+}
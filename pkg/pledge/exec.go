@@ -3,6 +3,7 @@ package pledge
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,14 +11,20 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
-	"github.com/hashicorp/go-set/v2"
+	"github.com/shoenig/nomad-pledge/pkg/landlock"
+	"github.com/shoenig/nomad-pledge/pkg/mountns"
+	"github.com/shoenig/nomad-pledge/pkg/reaper"
 	"github.com/shoenig/nomad-pledge/pkg/resources"
 	"github.com/shoenig/nomad-pledge/pkg/resources/process"
+	"github.com/shoenig/nomad-pledge/pkg/sandbox"
+	"github.com/shoenig/nomad-pledge/pkg/shim"
 	"golang.org/x/sys/unix"
 )
 
@@ -29,11 +36,32 @@ type Environment struct {
 	Err       io.WriteCloser    // stderr handle
 	Env       map[string]string // environment variables
 	Dir       string            // task directory
+	Tmp       string            // task private temporary directory
 	Cgroup    string            // task cgroup path
 	Net       string            // allocation network namespace path
 	Memory    uint64            // memory
 	MemoryMax uint64            // memory_max
 	Bandwidth uint64            // cpu / cores bandwidth (X/100_000)
+	UserNS    *IDMap            // user namespace id mapping (optional)
+	Events    EventFunc         // receives task events (optional)
+	Shim      string            // supervisor executable (optional)
+	Init      string            // init executable, runs as PID 1 and applies network rules (optional)
+	PidJoin   int               // host pid of a process whose pid namespace is joined (optional)
+	IpcJoin   int               // host pid of a process whose ipc namespace is joined (optional)
+	Exit      string            // file the supervisor records the exit status into
+	Sandbox   string            // native sandbox executable, used instead of the pledge executable (optional)
+	Dynamic   uint32            // uid and gid of a dynamic user, used instead of User (optional)
+	Root      string            // private root emulating unveil with a mount namespace, without landlock (optional)
+}
+
+// EventFunc is called with the message and annotations of a task event.
+type EventFunc func(message string, annotations map[string]string)
+
+// IDMap describes the range of host uids and gids mapped into a user
+// namespace, beginning with root.
+type IDMap struct {
+	Host uint32 // first host uid and gid, mapped to root
+	Size uint32 // number of uids and gids mapped
 }
 
 func (o *Options) String() string {
@@ -49,15 +77,34 @@ func New(bin string, env *Environment, opts *Options) Exec {
 	}
 }
 
-func Recover(pid int, env *Environment) Exec {
-	return &exe{
-		pid:    pid,
-		env:    env,
-		opts:   nil, // necessary?
-		waiter: process.WaitOnOrphan(pid),
-		signal: process.Interrupts(pid),
-		cpu:    new(resources.TrackCPU),
+// Recover the process with pid, supervised by the process with shimPID. The
+// exit status of a process without a supervisor (shimPID is 0) can only be
+// guessed.
+func Recover(pid, shimPID int, env *Environment, opts *Options) Exec {
+	waiter := process.WaitOnOrphan(pid)
+	if shimPID > 0 {
+		waiter = process.WaitOnOrphanSupervisor(shimPID, env.Exit, func(pid int) bool {
+			return shim.Is(pid, env.Exit)
+		})
+	}
+	e := &exe{
+		pid:       pid,
+		shim:      shimPID,
+		env:       env,
+		opts:      opts,
+		waiter:    waiter,
+		signal:    process.Interrupts(pid),
+		cpu:       new(resources.TrackCPU),
+		recovered: true,
+	}
+
+	// the user of the process may no longer exist
+	name, home := env.User, ""
+	if cred, err := e.credential(); err == nil {
+		name, home = cred.Name, cred.Home
 	}
+	e.environ = flatten(name, home, env.Tmp, env.Env, opts.EnvPolicies)
+	return e
 }
 
 type Exec interface {
@@ -69,6 +116,12 @@ type Exec interface {
 	// Must be called after Start.
 	PID() int
 
+	// ShimPID returns the process ID of the supervisor of the process, or 0
+	// if the process is not supervised.
+	//
+	// Must be called after Start.
+	ShimPID() int
+
 	// Wait on the process.
 	//
 	// Must be called after Start.
@@ -89,6 +142,36 @@ type Exec interface {
 	// Must be called after Start.
 	Stop(string, time.Duration) error
 
+	// Kill the process, ignoring the stop policy of the task.
+	//
+	// Must be called after Start.
+	Kill(string, time.Duration) error
+
+	// Freeze every process of the task cgroup.
+	//
+	// Must be called after Start.
+	Freeze() error
+
+	// Thaw every process of the task cgroup.
+	//
+	// Must be called after Start.
+	Thaw() error
+
+	// Frozen returns whether the task cgroup is set to be frozen.
+	//
+	// Must be called after Start.
+	Frozen() bool
+
+	// Environment returns the effective environment of the process, with
+	// the values of redacted variables masked.
+	//
+	// Must be called after Start.
+	Environment() map[string]string
+
+	// Render how the process is sandboxed, with the values of redacted
+	// variables masked. Recovered processes cannot be rendered.
+	Render() (*Rendering, error)
+
 	// Result of the process after completion.
 	//
 	// Must be called after Wait.
@@ -109,36 +192,142 @@ type exe struct {
 
 	// comes from runtime
 	pid    int
+	shim   int
 	cpu    *resources.TrackCPU
 	waiter process.Waiter
 	signal process.Signaler
 	code   int
+
+	// the environment of the process, computed once it is started
+	environ []string
+
+	// the host pid of the init of the process, once found
+	initLock sync.Mutex
+	initPID  int
+
+	// whether the process was recovered, in which case the environment
+	// describes the sandbox only partially
+	recovered bool
 }
 
-// lookup returns the uid, gid, and home directory of the given user.
-func lookup(name string) (uint32, uint32, string, error) {
+// Credential describes the identity a command will run as.
+type Credential struct {
+	Name    string   // user name
+	UID     uint32   // user id
+	GID     uint32   // primary group id
+	Groups  []uint32 // supplementary group ids
+	Home    string   // home directory
+	HostUID uint32   // user id outside of any user namespace
+	HostGID uint32   // group id outside of any user namespace
+}
+
+// DynamicUser is the name of dynamic users, which have no entry in the user
+// database.
+const DynamicUser = "dynamic"
+
+// credential returns the identity the command will run as, which is root
+// when running in a user namespace, or the dynamic user of the task.
+func (e *exe) credential() (*Credential, error) {
+	if m := e.env.UserNS; m != nil {
+		return &Credential{
+			Name:    "root",
+			UID:     0,
+			GID:     0,
+			Home:    e.env.Dir,
+			HostUID: m.Host,
+			HostGID: m.Host,
+		}, nil
+	}
+	if id := e.env.Dynamic; id > 0 {
+		return &Credential{
+			Name:    DynamicUser,
+			UID:     id,
+			GID:     id,
+			Home:    e.env.Dir,
+			HostUID: id,
+			HostGID: id,
+		}, nil
+	}
+	return Lookup(e.env.User, e.opts.Group)
+}
+
+// Lookup returns the credential of the given user. The primary group is that
+// of the user, unless group is set. The supplementary groups are those of the
+// user according to the group database.
+func Lookup(name, group string) (*Credential, error) {
 	u, err := user.Lookup(name)
 	if err != nil {
-		return 0, 0, "", fmt.Errorf("failed to find user %q: %w", name, err)
+		return nil, fmt.Errorf("failed to find user %q: %w", name, err)
 	}
 
 	uid, err := strconv.ParseInt(u.Uid, 10, 32)
 	if err != nil {
-		return 0, 0, "", fmt.Errorf("failed to decode uid for user %q: %w", name, err)
+		return nil, fmt.Errorf("failed to decode uid for user %q: %w", name, err)
+	}
+
+	gidS := u.Gid
+	if group != "" {
+		g, gErr := LookupGroup(group)
+		if gErr != nil {
+			return nil, gErr
+		}
+		gidS = g.Gid
 	}
 
-	gid, err := strconv.ParseInt(u.Gid, 10, 32)
+	gid, err := strconv.ParseInt(gidS, 10, 32)
 	if err != nil {
-		return 0, 0, "", fmt.Errorf("failed to decode gid for user %q: %w", name, err)
+		return nil, fmt.Errorf("failed to decode gid for user %q: %w", name, err)
 	}
 
-	return uint32(uid), uint32(gid), u.HomeDir, nil
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find groups for user %q: %w", name, err)
+	}
+
+	groups := make([]uint32, 0, len(ids))
+	for _, id := range ids {
+		g, gErr := strconv.ParseInt(id, 10, 32)
+		if gErr != nil {
+			return nil, fmt.Errorf("failed to decode group id for user %q: %w", name, gErr)
+		}
+		groups = append(groups, uint32(g))
+	}
+
+	return &Credential{
+		Name:    name,
+		UID:     uint32(uid),
+		GID:     uint32(gid),
+		Groups:  groups,
+		Home:    u.HomeDir,
+		HostUID: uint32(uid),
+		HostGID: uint32(gid),
+	}, nil
+}
+
+// LookupGroup finds a group by name, or by id if group is numeric.
+func LookupGroup(group string) (*user.Group, error) {
+	if _, err := strconv.Atoi(group); err == nil {
+		g, err := user.LookupGroupId(group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find group %q: %w", group, err)
+		}
+		return g, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find group %q: %w", group, err)
+	}
+	return g, nil
 }
 
 func (e *exe) PID() int {
 	return e.pid
 }
 
+func (e *exe) ShimPID() int {
+	return e.shim
+}
+
 func (e *exe) openCG() (int, func(), error) {
 	fd, err := unix.Open(e.env.Cgroup, unix.O_PATH, 0)
 	cleanup := func() {
@@ -165,53 +354,147 @@ func (e *exe) writeCG(file, content string) error {
 	return f.Close()
 }
 
-func flatten(user, home string, env map[string]string) []string {
-	useless := set.From([]string{"LS_COLORS", "XAUTHORITY", "DISPLAY", "COLORTERM", "MAIL", "TMPDIR"})
-	result := make([]string, 0, len(env))
-	for k, v := range env {
-		switch {
-		case k == "USER": // set correct $USER
-			result = append(result, "USER="+user)
-		case k == "HOME": // set correct $HOME
-			result = append(result, "HOME="+home)
-		case useless.Contains(k): // purge useless vars
-			continue
-		case v == "":
-			result = append(result, k)
-		default:
-			result = append(result, k+"="+v)
+// private creates the private temporary directory of the task, accessible
+// only to the user the command will run as. The parent directory must already
+// exist. Anything other than a directory left at the path by a previous run of
+// the task, such as a symlink, is replaced rather than followed.
+func (e *exe) private(cred *Credential) error {
+	if info, err := os.Lstat(e.env.Tmp); err == nil && !info.IsDir() {
+		if err = os.Remove(e.env.Tmp); err != nil {
+			return fmt.Errorf("failed to replace private tmp directory: %w", err)
 		}
 	}
-	result = append(result, "TMPDIR="+os.TempDir())
-	return result
+	if err := os.Mkdir(e.env.Tmp, 0o700); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create private tmp directory: %w", err)
+	}
+
+	// change the directory through a descriptor, so that a symlink replacing
+	// the directory in the meantime is not followed
+	f, err := os.OpenFile(e.env.Tmp, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open private tmp directory: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if err = f.Chown(int(cred.HostUID), int(cred.HostGID)); err != nil {
+		return fmt.Errorf("failed to set owner of private tmp directory: %w", err)
+	}
+	if err = f.Chmod(0o700); err != nil {
+		return fmt.Errorf("failed to set mode of private tmp directory: %w", err)
+	}
+	return nil
 }
 
-func (e *exe) parameters(uid, gid uint32) []string {
+func (e *exe) parameters(cred *Credential) []string {
 	var result []string
 
-	// start with nsenter if using bridge mode
-	if net := e.env.Net; net != "" {
-		result = append(
-			result,
-			"nsenter",
-			"--no-fork",
-			fmt.Sprintf("--net=%s", net),
-			"--",
+	// start with choom if adjusting the oom killer score, which every process
+	// of the task inherits, including the init
+	if adj := e.opts.OOMScoreAdj; adj != nil {
+		result = append(result, "choom", "-n", strconv.Itoa(*adj), "--")
+	}
+
+	// and chrt if changing the scheduling policy, which is also inherited
+	switch e.opts.Importance.Policy {
+	case resources.PolicyBatch, resources.PolicyIdle:
+		result = append(result, "chrt", "--"+e.opts.Importance.Policy, "0", "--")
+	}
+
+	// then nsenter if using bridge mode, or joining the namespaces
+	// shared by tasks of the allocation
+	if e.env.Net != "" || e.env.PidJoin > 0 || e.env.IpcJoin > 0 {
+		result = append(result, "nsenter")
+
+		// joining a pid namespace only applies to children
+		if e.env.PidJoin == 0 {
+			result = append(result, "--no-fork")
+		}
+		if net := e.env.Net; net != "" {
+			result = append(result, fmt.Sprintf("--net=%s", net))
+		}
+		if pid := e.env.PidJoin; pid > 0 {
+			result = append(result, fmt.Sprintf("--pid=/proc/%d/ns/pid", pid))
+		}
+		if pid := e.env.IpcJoin; pid > 0 {
+			result = append(result, fmt.Sprintf("--ipc=/proc/%d/ns/ipc", pid))
+		}
+		result = append(result, "--")
+	}
+
+	// setup unshare for user, ipc, pid namespaces
+	result = append(result, "unshare")
+	if m := e.env.UserNS; m != nil {
+		result = append(result,
+			"--user",
+			fmt.Sprintf("--map-users=%d,0,%d", m.Host, m.Size),
+			fmt.Sprintf("--map-groups=%d,0,%d", m.Host, m.Size),
+		)
+	}
+	if e.env.IpcJoin == 0 {
+		result = append(result, "--ipc")
+	}
+	switch e.env.PidJoin {
+	case 0:
+		result = append(result,
+			"--pid",
+			"--mount-proc",
+			"--fork",
+			"--kill-child=SIGKILL",
 		)
+	default:
+		// the init of the namespace being joined is PID 1
+		result = append(result, "--mount-proc")
 	}
+	result = append(result, "--")
+
+	// restrict tcp ports with landlock network rules, while still privileged
+	if ports := e.opts.Ports; ports != nil && e.env.Init != "" {
+		result = append(result, e.env.Init)
+		result = append(result, landlock.Arguments(ports, nil)...)
+	}
+
+	// the list of unveils, including the private tmp directory
+	unveil := e.unveil()
 
-	// setup unshare for ipc, pid namespaces
+	// the user command and args
+	command := append([]string{e.opts.Command}, e.opts.Arguments...)
+
+	// emulate unveil with a private root of bind mounts, while still
+	// privileged, in which case unveil is not applied again by pledge
+	if e.env.Root != "" && len(unveil) > 0 && e.env.Init != "" {
+		// the pledge executable is an actually portable executable, which is
+		// started by the shell
+		executables := []string{e.env.Init, e.bin, "sh", e.opts.Command}
+		if e.env.Sandbox != "" {
+			executables = []string{e.env.Init, e.env.Sandbox, e.opts.Command}
+		}
+		result = append(result, e.env.Init)
+		result = append(result, mountns.Arguments(e.env.Root, unveil, executables, nil)...)
+		unveil = nil
+	}
+
+	// setup setpriv for user, groups, and capabilities
 	result = append(result,
-		"unshare",
-		"--ipc",
-		"--pid",
-		"--mount-proc",
-		"--fork",
-		"--kill-child=SIGKILL",
-		"--setuid", strconv.Itoa(int(uid)),
-		"--setgid", strconv.Itoa(int(gid)),
-		"--",
+		"setpriv",
+		"--reuid", strconv.Itoa(int(cred.UID)),
+		"--regid", strconv.Itoa(int(cred.GID)),
 	)
+	result = append(result, groups(cred.Groups)...)
+	result = append(result, e.capabilities()...)
+	result = append(result, "--")
+
+	// run an init as PID 1 (or as a subreaper when joining a pid namespace)
+	// to reap orphans and forward signals, with no more privileges than the
+	// command; the stages before it are replaced by exec and keep its pid
+	if e.env.Init != "" {
+		result = append(result, e.env.Init)
+		result = append(result, reaper.Arguments(nil)...)
+	}
+
+	// setup native sandbox invocation
+	if e.env.Sandbox != "" {
+		result = append(result, e.env.Sandbox)
+		return append(result, sandbox.Arguments(e.opts.Promises, e.opts.ExecPromises, e.opts.Report, e.env.Tmp, unveil, command)...)
+	}
 
 	// setup pledge invocation
 	result = append(result, e.bin)
@@ -222,20 +505,67 @@ func (e *exe) parameters(uid, gid uint32) []string {
 	}
 
 	// append the list of unveils
-	for _, u := range e.opts.Unveil {
+	for _, u := range unveil {
 		result = append(result, "-v", u)
 	}
 
 	// separate user command and args
 	result = append(result, "--")
 
-	// append the user command
-	result = append(result, e.opts.Command)
-	if len(e.opts.Arguments) > 0 {
-		result = append(result, e.opts.Arguments...)
+	// craft complete result
+	return append(result, command...)
+}
+
+// unveil returns the unveil rules of the command, including the private tmp
+// directory, or nothing if the command is not restricted by unveil.
+func (e *exe) unveil() []string {
+	if len(e.opts.Unveil) == 0 {
+		return nil
+	}
+	return append(slices.Clone(e.opts.Unveil), "rwc:"+e.env.Tmp)
+}
+
+// groups returns the setpriv arguments for setting the supplementary groups.
+func groups(ids []uint32) []string {
+	if len(ids) == 0 {
+		return []string{"--clear-groups"}
+	}
+	list := make([]string, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, strconv.Itoa(int(id)))
+	}
+	return []string{"--groups", strings.Join(list, ",")}
+}
+
+// capabilities returns the setpriv arguments for granting ambient capabilities
+// and dropping capabilities from the bounding set.
+func (e *exe) capabilities() []string {
+	var result []string
+
+	// ambient capabilities must also be inheritable
+	if len(e.opts.CapAdd) > 0 {
+		adding := make([]string, 0, len(e.opts.CapAdd))
+		for _, c := range e.opts.CapAdd {
+			adding = append(adding, "+"+c)
+		}
+		list := strings.Join(adding, ",")
+		result = append(result, "--inh-caps="+list, "--ambient-caps="+list)
+	}
+
+	// dropping all must come before re-adding anything that was granted
+	if len(e.opts.CapDrop) > 0 {
+		dropping := make([]string, 0, len(e.opts.CapDrop))
+		for _, c := range e.opts.CapDrop {
+			dropping = append(dropping, "-"+c)
+		}
+		if slices.Contains(e.opts.CapDrop, "all") {
+			for _, c := range e.opts.CapAdd {
+				dropping = append(dropping, "+"+c)
+			}
+		}
+		result = append(result, "--bounding-set="+strings.Join(dropping, ","))
 	}
 
-	// craft complete result
 	return result
 }
 
@@ -243,33 +573,53 @@ func (e *exe) parameters(uid, gid uint32) []string {
 // to create the underlying .ape and sandbox.so files in the tmp directory
 // specified. This is a workaround for some weird issue where creating these
 // files does not work while in a cgroup, as is the case during normal start.
-func (e *exe) prepare(uid, gid uint32) error {
+func (e *exe) prepare(cred *Credential) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, e.bin, "-h")
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid:    true, // ignore signals sent to nomad
-		Credential: &syscall.Credential{Uid: uid, Gid: gid},
+		Credential: &syscall.Credential{Uid: cred.HostUID, Gid: cred.HostGID, Groups: cred.Groups},
 	}
-	cmd.Env = []string{fmt.Sprintf("TMPDIR=%s", os.TempDir())}
+	cmd.Env = []string{fmt.Sprintf("TMPDIR=%s", e.env.Tmp)}
 	return cmd.Run()
 }
 
 func (e *exe) Start(ctx Ctx) error {
-	uid, gid, home, err := lookup(e.env.User)
+	if e.opts.Ports != nil && e.env.Init == "" {
+		return fmt.Errorf("network rules require an init executable")
+	}
+	if e.env.Root != "" && e.env.Init == "" {
+		return fmt.Errorf("unveil emulation requires an init executable")
+	}
+
+	cred, err := e.credential()
 	if err != nil {
 		return fmt.Errorf("failed to start command without user: %w", err)
 	}
+	e.environ = flatten(cred.Name, cred.Home, e.env.Tmp, e.env.Env, e.opts.EnvPolicies)
 
-	// prepare sandbox.so library before launching real command in cgroup
-	if err = e.prepare(uid, gid); err != nil {
-		return fmt.Errorf("failed to prestart command: %w", err)
+	// create the private tmp directory for the task
+	if err = e.private(cred); err != nil {
+		return err
 	}
 
-	// find our cgroup descriptor
-	fd, cleanup, err := e.openCG()
-	if err != nil {
-		return fmt.Errorf("failed to open cgroup for descriptor")
+	// the dynamic loader of the command is allowed more than its promises,
+	// for as long as the command runs
+	if e.env.Sandbox != "" {
+		if path, lErr := exec.LookPath(e.opts.Command); lErr == nil && sandbox.Widens(path, e.opts.Promises) {
+			e.emit("Dynamically linked command may open files read-only and map executable memory beyond its promises", map[string]string{
+				"command": path,
+			})
+		}
+	}
+
+	// prepare sandbox.so library before launching real command in cgroup,
+	// which the native sandbox does not need
+	if e.env.Sandbox == "" {
+		if err = e.prepare(cred); err != nil {
+			return fmt.Errorf("failed to prestart command: %w", err)
+		}
 	}
 
 	// set resource constraints
@@ -277,8 +627,19 @@ func (e *exe) Start(ctx Ctx) error {
 		return fmt.Errorf("failed to write resource constraints to cgroup: %w", err)
 	}
 
+	// hand the sandbox over to a supervisor that outlives the plugin
+	if e.env.Shim != "" {
+		return e.supervise(cred)
+	}
+
+	// find our cgroup descriptor
+	fd, cleanup, err := e.openCG()
+	if err != nil {
+		return fmt.Errorf("failed to open cgroup for descriptor")
+	}
+
 	// a sandbox using nsenter, unshare, pledge, and our cgroup
-	cmd := e.isolation(ctx, home, fd, uid, gid)
+	cmd := e.isolation(ctx, fd, cred)
 	if err = cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start command: %w", err)
 	}
@@ -293,12 +654,12 @@ func (e *exe) Start(ctx Ctx) error {
 	return nil
 }
 
-func (e *exe) isolation(ctx Ctx, home string, fd int, uid, gid uint32) *exec.Cmd {
-	params := e.parameters(uid, gid)
+func (e *exe) isolation(ctx Ctx, fd int, cred *Credential) *exec.Cmd {
+	params := e.parameters(cred)
 	cmd := exec.CommandContext(ctx, params[0], params[1:]...)
 	cmd.Stdout = e.env.Out
 	cmd.Stderr = e.env.Err
-	cmd.Env = flatten(e.env.User, home, e.env.Env)
+	cmd.Env = e.environ
 	cmd.Dir = e.env.Dir
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		UseCgroupFD: true, // clone directly into cgroup
@@ -308,25 +669,101 @@ func (e *exe) isolation(ctx Ctx, home string, fd int, uid, gid uint32) *exec.Cmd
 	return cmd
 }
 
-// set resource constraints via cgroups
-func (e *exe) constrain() error {
+// supervise starts the sandbox through a supervisor process, which clones the
+// sandbox into our cgroup, reaps it, and records its exit status. The
+// supervisor is started in its own session without a context, so that it
+// keeps running if the plugin is stopped or restarted.
+func (e *exe) supervise(cred *Credential) error {
+	report, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create supervisor pipe: %w", err)
+	}
+	defer func() { _ = report.Close() }()
+
+	args := shim.Arguments(&shim.Config{
+		Exit:   e.env.Exit,
+		Cgroup: e.env.Cgroup,
+		Args:   e.parameters(cred),
+	})
+	cmd := exec.Command(e.env.Shim, args...)
+	cmd.Stdout = e.env.Out
+	cmd.Stderr = e.env.Err
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Env = e.environ
+	cmd.Dir = e.env.Dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true, // detach from the plugin
+	}
+	err = cmd.Start()
+	_ = w.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start supervisor: %w", err)
+	}
+
+	pid, err := shim.ReadReport(report)
+	if err != nil {
+		_, _ = cmd.Process.Wait()
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	e.pid = pid
+	e.shim = cmd.Process.Pid
+	e.waiter = process.WaitOnSupervisor(cmd.Process, e.env.Exit)
+	e.signal = process.Interrupts(pid)
+
+	return nil
+}
+
+// CgroupWrite is a value written to a file of the task cgroup.
+type CgroupWrite struct {
+	File     string `json:"file"`
+	Content  string `json:"content"`
+	Required bool   `json:"required"` // whether the task fails to start if the write fails
+}
+
+// cgroupWrites returns the writes that set the resource constraints of the
+// task cgroup, in order.
+func (e *exe) cgroupWrites() []CgroupWrite {
 	// set cpu bandwidth
-	_ = e.writeCG("cpu.max", fmt.Sprintf("%d 100000", e.env.Bandwidth))
+	writes := []CgroupWrite{{File: "cpu.max", Content: fmt.Sprintf("%d 100000", e.env.Bandwidth)}}
 
 	// will want to set burst one day, but in coordination with nomad
 
 	// set memory limits
 	switch e.env.MemoryMax {
 	case 0:
-		_ = e.writeCG("memory.max", fmt.Sprintf("%d", e.env.Memory))
+		writes = append(writes, CgroupWrite{File: "memory.max", Content: strconv.FormatUint(e.env.Memory, 10)})
 	default:
-		_ = e.writeCG("memory.low", fmt.Sprintf("%d", e.env.Memory))
-		_ = e.writeCG("memory.max", fmt.Sprintf("%d", e.env.MemoryMax))
+		writes = append(writes,
+			CgroupWrite{File: "memory.low", Content: strconv.FormatUint(e.env.Memory, 10)},
+			CgroupWrite{File: "memory.max", Content: strconv.FormatUint(e.env.MemoryMax, 10)},
+		)
 	}
 
 	// set CPU priority niceness
-	_ = e.writeCG("cpu.weight.nice", strconv.Itoa(e.opts.Importance.Nice))
+	writes = append(writes, CgroupWrite{File: "cpu.weight.nice", Content: strconv.Itoa(e.opts.Importance.Nice)})
+
+	// set io priority weight, if the io controller is available
+	if w := e.opts.Importance.IOWeight; w > 0 {
+		writes = append(writes, CgroupWrite{File: "io.weight", Content: fmt.Sprintf("default %d", w)})
+	}
+
+	// kill every process of the task together when one is chosen by the oom
+	// killer, rather than leaving the task partially running
+	if e.opts.OOMGroup {
+		writes = append(writes, CgroupWrite{File: "memory.oom.group", Content: "1", Required: true})
+	}
+
+	return writes
+}
 
+// set resource constraints via cgroups
+func (e *exe) constrain() error {
+	for _, w := range e.cgroupWrites() {
+		if err := e.writeCG(w.File, w.Content); err != nil && w.Required {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -336,26 +773,166 @@ func (e *exe) Wait() error {
 	return exit.Err
 }
 
+func (e *exe) Environment() map[string]string {
+	return masked(e.environ, e.opts.EnvPolicies)
+}
+
 func (e *exe) Result() int {
 	return e.code
 }
 
+// Signal the process. Signals are delivered to the init of the task, which
+// forwards them to the command, so that they do not terminate the processes
+// setting up the sandbox. Signals the init cannot catch, such as SIGSTOP, are
+// instead delivered to the process groups of the command. Without an init,
+// signals are delivered to the whole process group.
 func (e *exe) Signal(signal string) error {
-	return e.signal.Signal(signal)
+	pid, exists := e.init()
+	switch {
+	case !exists:
+		return e.signal.Signal(signal)
+	case process.Uncatchable(signal):
+		if groups := processGroups(process.Children(pid)); len(groups) > 0 {
+			var err error
+			for _, group := range groups {
+				err = errors.Join(err, process.Interrupts(group).Signal(signal))
+			}
+			return err
+		}
+	}
+	return process.InterruptsProcess(pid).Signal(signal)
+}
+
+// processGroups returns the distinct process groups of pids.
+func processGroups(pids []int) []int {
+	var result []int
+	for _, pid := range pids {
+		if group, err := process.Group(pid); err == nil && !slices.Contains(result, group) {
+			result = append(result, group)
+		}
+	}
+	return result
 }
 
+// init returns the host pid of the init process of the task, if the task is
+// running beneath an init. The process tree of the task is only searched until
+// the init is found, after which only the cmdline of the init is checked, to
+// make sure the pid has not been reused since the init exited.
+func (e *exe) init() (int, bool) {
+	if e.env.Init == "" {
+		return 0, false
+	}
+
+	e.initLock.Lock()
+	defer e.initLock.Unlock()
+
+	if e.initPID > 0 && e.isInit(e.initPID) {
+		return e.initPID, true
+	}
+	pid, exists := process.Find(e.pid, e.isInit)
+	if exists {
+		e.initPID = pid
+	}
+	return pid, exists
+}
+
+// isInit returns whether pid is the init process of the task.
+func (e *exe) isInit(pid int) bool {
+	args := process.Cmdline(pid)
+	return len(args) > 1 && args[0] == e.env.Init && args[1] == reaper.Command
+}
+
+// Stop the process by escalating through the steps of the stop policy of the
+// task, or by sending signal and waiting for timeout if there is no policy.
+// If processes remain after the final step, the whole cgroup is killed.
 func (e *exe) Stop(signal string, timeout time.Duration) error {
-	// politely ask the group to terminate via user specified signal
-	err := e.Signal(signal)
-	if e.blockPIDs(timeout) {
-		// no more mr. nice guy, kill the whole cgroup
-		_ = e.writeCG("cgroup.kill", "1")
-		_ = e.env.Out.Close()
-		_ = e.env.Err.Close()
+	steps := e.opts.StopSteps
+	if len(steps) == 0 {
+		steps = []Step{{Signal: signal, Timeout: timeout}}
 	}
+	return e.escalate(steps)
+}
+
+// Kill the process by sending signal and waiting for timeout, regardless of
+// the stop policy of the task, so that the time taken is bounded by timeout.
+// If processes remain, the whole cgroup is killed.
+func (e *exe) Kill(signal string, timeout time.Duration) error {
+	return e.escalate([]Step{{Signal: signal, Timeout: timeout}})
+}
+
+// escalate through steps, killing the whole cgroup if processes remain after
+// the final step.
+func (e *exe) escalate(steps []Step) error {
+	var err error
+	for i, step := range steps {
+		// politely ask the group to terminate via the step signal
+		e.emit(fmt.Sprintf("Sending %s to task", step.Signal), map[string]string{
+			"signal":  step.Signal,
+			"timeout": step.Timeout.String(),
+			"step":    fmt.Sprintf("%d/%d", i+1, len(steps)),
+		})
+		if sigErr := e.Signal(step.Signal); sigErr != nil && err == nil {
+			err = sigErr
+		}
+		if !e.blockPIDs(step.Timeout) {
+			return err
+		}
+	}
+
+	// stop processes from forking or reacting while being killed
+	if e.opts.StopFreeze {
+		e.emit("Freezing task cgroup", nil)
+		_ = e.writeCG("cgroup.freeze", "1")
+	}
+
+	// no more mr. nice guy, kill the whole cgroup
+	e.emit("Killing task cgroup", nil)
+	_ = e.writeCG("cgroup.kill", "1")
+	_ = e.env.Out.Close()
+	_ = e.env.Err.Close()
 	return err
 }
 
+// freezeTimeout is how long to wait for the cgroup to become frozen or thawed
+const freezeTimeout = 5 * time.Second
+
+func (e *exe) Freeze() error {
+	if err := e.writeCG("cgroup.freeze", "1"); err != nil {
+		return fmt.Errorf("failed to freeze cgroup: %w", err)
+	}
+	if err := e.blockFrozen(true, freezeTimeout); err != nil {
+		return err
+	}
+	e.emit("Task frozen", nil)
+	return nil
+}
+
+func (e *exe) Thaw() error {
+	if err := e.writeCG("cgroup.freeze", "0"); err != nil {
+		return fmt.Errorf("failed to thaw cgroup: %w", err)
+	}
+	if err := e.blockFrozen(false, freezeTimeout); err != nil {
+		return err
+	}
+	e.emit("Task thawed", nil)
+	return nil
+}
+
+// Frozen returns whether the task cgroup is set to be frozen according to
+// cgroup.freeze, which unlike cgroup.events does not depend on whether every
+// process has been frozen yet.
+func (e *exe) Frozen() bool {
+	s, _ := e.readCG("cgroup.freeze")
+	return s == "1"
+}
+
+// emit a task event, if the environment is configured to receive them.
+func (e *exe) emit(message string, annotations map[string]string) {
+	if e.env.Events != nil {
+		e.env.Events(message, annotations)
+	}
+}
+
 func (e *exe) Stats() resources.Utilization {
 	memCurrentS, _ := e.readCG("memory.current")
 	memCurrent, _ := strconv.Atoi(memCurrentS)
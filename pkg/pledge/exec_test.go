@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/shoenig/nomad-pledge/pkg/resources"
 	"github.com/shoenig/nomad-pledge/pkg/util"
@@ -101,3 +103,215 @@ workingset_restore_file 0
 	value := extractRe(content, memCacheRe)
 	must.Eq(t, 12386787328, value)
 }
+
+func TestExec_frozen(t *testing.T) {
+	dir := t.TempDir()
+	e := &exe{env: &Environment{Cgroup: dir}}
+	events := filepath.Join(dir, "cgroup.events")
+
+	must.NoError(t, os.WriteFile(events, []byte("populated 1\nfrozen 1\n"), 0644))
+	frozen, err := e.frozen()
+	must.NoError(t, err)
+	must.True(t, frozen)
+	must.NoError(t, e.blockFrozen(true, time.Second))
+
+	must.NoError(t, os.WriteFile(events, []byte("populated 1\nfrozen 0\n"), 0644))
+	frozen, err = e.frozen()
+	must.NoError(t, err)
+	must.False(t, frozen)
+	must.Error(t, e.blockFrozen(true, 50*time.Millisecond))
+}
+
+func TestExec_private(t *testing.T) {
+	// like the tmp directory managed by nomad
+	parent := t.TempDir()
+	must.NoError(t, os.Chmod(parent, 0o777|os.ModeSticky))
+	env, _, _ := testEnv()
+	env.Tmp = filepath.Join(parent, "pledge")
+	e := &exe{env: env}
+	cred := &Credential{HostUID: uint32(os.Getuid()), HostGID: uint32(os.Getgid())}
+
+	must.NoError(t, e.private(cred))
+	info, err := os.Lstat(env.Tmp)
+	must.NoError(t, err)
+	must.True(t, info.IsDir())
+	must.Eq(t, os.FileMode(0o700), info.Mode().Perm())
+
+	// the parent is left alone
+	parentInfo, err := os.Stat(parent)
+	must.NoError(t, err)
+	must.Eq(t, 0o777|os.ModeSticky, parentInfo.Mode()&(os.ModePerm|os.ModeSticky))
+
+	// an existing directory is reused, with its mode restored
+	must.NoError(t, os.Chmod(env.Tmp, 0o777))
+	must.NoError(t, e.private(cred))
+	info, err = os.Lstat(env.Tmp)
+	must.NoError(t, err)
+	must.Eq(t, os.FileMode(0o700), info.Mode().Perm())
+
+	// a symlink left in its place is replaced, not followed
+	target := t.TempDir()
+	must.NoError(t, os.Chmod(target, 0o755))
+	must.NoError(t, os.Remove(env.Tmp))
+	must.NoError(t, os.Symlink(target, env.Tmp))
+	must.NoError(t, e.private(cred))
+	info, err = os.Lstat(env.Tmp)
+	must.NoError(t, err)
+	must.True(t, info.IsDir())
+	targetInfo, err := os.Stat(target)
+	must.NoError(t, err)
+	must.Eq(t, os.FileMode(0o755), targetInfo.Mode().Perm())
+}
+
+func TestExec_private_missingParent(t *testing.T) {
+	env, _, _ := testEnv()
+	env.Tmp = filepath.Join(t.TempDir(), "missing", "pledge")
+	e := &exe{env: env}
+	cred := &Credential{HostUID: uint32(os.Getuid()), HostGID: uint32(os.Getgid())}
+	must.ErrorContains(t, e.private(cred), "failed to create private tmp directory")
+}
+
+func TestExec_unveil(t *testing.T) {
+	env, _, _ := testEnv()
+	env.Tmp = "/alloc/task/tmp/pledge"
+
+	// the private tmp directory is unveiled along with the task rules
+	opts := testOpts()
+	opts.Unveil = []string{"r:/etc"}
+	e := New("", env, opts).(*exe)
+	must.Eq(t, []string{"r:/etc", "rwc:/alloc/task/tmp/pledge"}, e.unveil())
+	must.Eq(t, []string{"r:/etc"}, opts.Unveil)
+
+	// but a task without unveil rules remains unrestricted
+	e = New("", env, testOpts()).(*exe)
+	must.Nil(t, e.unveil())
+}
+
+func TestExec_parameters_join(t *testing.T) {
+	env, _, _ := testEnv()
+	env.Net = "/var/run/netns/abc"
+	env.Init = "/opt/nomad/plugins/pledge"
+	env.PidJoin = 100
+	env.IpcJoin = 100
+
+	e := New("/opt/bin/pledge.com", env, testOpts()).(*exe)
+	params := e.parameters(&Credential{Name: "nobody", UID: 65534, GID: 65534})
+	must.Eq(t, []string{
+		"nsenter",
+		"--net=/var/run/netns/abc",
+		"--pid=/proc/100/ns/pid",
+		"--ipc=/proc/100/ns/ipc",
+		"--",
+		"unshare", "--mount-proc", "--",
+		"setpriv",
+	}, params[:9])
+
+	// the init runs with the privileges of the command
+	must.Eq(t, []string{
+		"--",
+		"/opt/nomad/plugins/pledge", "init", "--",
+		"/opt/bin/pledge.com",
+	}, params[len(params)-9:len(params)-4])
+}
+
+func TestExec_parameters_private(t *testing.T) {
+	env, _, _ := testEnv()
+	env.Init = "/opt/nomad/plugins/pledge"
+
+	e := New("/opt/bin/pledge.com", env, testOpts()).(*exe)
+	params := e.parameters(&Credential{Name: "nobody", UID: 65534, GID: 65534})
+	must.Eq(t, []string{
+		"unshare", "--ipc", "--pid", "--mount-proc", "--fork", "--kill-child=SIGKILL", "--",
+		"setpriv",
+	}, params[:8])
+
+	// the init runs with the privileges of the command
+	must.Eq(t, []string{
+		"--",
+		"/opt/nomad/plugins/pledge", "init", "--",
+		"/opt/bin/pledge.com",
+	}, params[len(params)-9:len(params)-4])
+}
+
+func TestExec_parameters_oomScoreAdj(t *testing.T) {
+	env, _, _ := testEnv()
+	env.Net = "/var/run/netns/abc"
+
+	adj := -500
+	opts := testOpts()
+	opts.OOMScoreAdj = &adj
+
+	e := New("/opt/bin/pledge.com", env, opts).(*exe)
+	params := e.parameters(&Credential{Name: "nobody", UID: 65534, GID: 65534})
+	must.Eq(t, []string{
+		"choom", "-n", "-500", "--",
+		"nsenter",
+	}, params[:5])
+}
+
+func TestExec_parameters_schedPolicy(t *testing.T) {
+	env, _, _ := testEnv()
+
+	adj := 500
+	opts := testOpts()
+	opts.OOMScoreAdj = &adj
+	opts.Importance.Policy = resources.PolicyIdle
+
+	e := New("/opt/bin/pledge.com", env, opts).(*exe)
+	params := e.parameters(&Credential{Name: "nobody", UID: 65534, GID: 65534})
+	must.Eq(t, []string{
+		"choom", "-n", "500", "--",
+		"chrt", "--idle", "0", "--",
+		"unshare",
+	}, params[:9])
+}
+
+func TestExec_parameters_mountns(t *testing.T) {
+	env, _, _ := testEnv()
+	env.Init = "/opt/nomad/plugins/pledge"
+	env.Root = "/alloc/task/private/root"
+
+	opts := testOpts()
+	opts.Unveil = []string{"r:/etc"}
+
+	e := New("/opt/bin/pledge.com", env, opts).(*exe)
+	params := e.parameters(&Credential{Name: "nobody", UID: 65534, GID: 65534})
+	must.Eq(t, []string{
+		"/opt/nomad/plugins/pledge", "mountns",
+		"-root", "/alloc/task/private/root",
+		"-v", "r:/etc",
+		"-v", "rwc:" + env.Tmp,
+		"-x", "/opt/nomad/plugins/pledge",
+		"-x", "/opt/bin/pledge.com",
+		"-x", "sh",
+		"-x", "echo",
+		"--",
+		"setpriv",
+	}, params[7:25])
+
+	// unveil is not applied again by pledge
+	must.Eq(t, []string{"/opt/bin/pledge.com", "--", "echo", "hello", "world"}, params[len(params)-5:])
+}
+
+func TestExec_parameters_sandbox(t *testing.T) {
+	env, _, _ := testEnv()
+	env.Sandbox = "/opt/nomad/plugins/pledge"
+
+	opts := testOpts()
+	opts.Promises = "stdio rpath"
+	opts.ExecPromises = "stdio rpath prot_exec"
+	opts.Unveil = []string{"r:/etc"}
+
+	e := New("", env, opts).(*exe)
+	params := e.parameters(&Credential{Name: "nobody", UID: 65534, GID: 65534})
+	must.Eq(t, []string{
+		"/opt/nomad/plugins/pledge", "sandbox",
+		"-p", "stdio rpath",
+		"-e", "stdio rpath prot_exec",
+		"-v", "r:/etc",
+		"-v", "rwc:" + env.Tmp,
+		"--",
+		"echo", "hello", "world",
+	}, params[len(params)-14:])
+	must.Eq(t, []string{"r:/etc"}, opts.Unveil)
+}
@@ -1,7 +1,9 @@
 package pledge
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -49,3 +51,43 @@ func (e *exe) blockPIDs(timeout time.Duration) bool {
 		}
 	}
 }
+
+// frozen returns whether the cgroup is currently frozen, according to
+// the cgroup.events file.
+func (e *exe) frozen() (bool, error) {
+	s, err := e.readCG("cgroup.events")
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(s, "\n") {
+		if value, ok := strings.CutPrefix(line, "frozen "); ok {
+			return value == "1", nil
+		}
+	}
+	return false, fmt.Errorf("cgroup.events missing frozen state")
+}
+
+// blockFrozen blocks until the frozen state of the cgroup matches the given
+// state, returning an error if the timeout is exceeded or an error occurs.
+func (e *exe) blockFrozen(state bool, timeout time.Duration) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	abort := time.After(timeout)
+
+	for {
+		current, err := e.frozen()
+		switch {
+		case err != nil:
+			return fmt.Errorf("failed to read cgroup frozen state: %w", err)
+		case current == state:
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-abort:
+			return fmt.Errorf("timeout waiting for cgroup frozen state %t", state)
+		}
+	}
+}
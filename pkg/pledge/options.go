@@ -1,6 +1,9 @@
 package pledge
 
 import (
+	"time"
+
+	"github.com/shoenig/nomad-pledge/pkg/landlock"
 	"github.com/shoenig/nomad-pledge/pkg/resources"
 )
 
@@ -10,4 +13,39 @@ type Options struct {
 	Promises   string
 	Unveil     []string
 	Importance *resources.Importance
+	CapAdd     []string // ambient capabilities to grant
+	CapDrop    []string // capabilities to remove from the bounding set
+	Version    string   // name of the pledge executable to use
+	Group      string   // primary group the command will run as (optional)
+	UserNS     bool     // run as root in a user namespace
+	Dynamic    bool     // run as a dynamic user allocated to the task
+	SharePID   bool     // share the pid namespace with tasks of the allocation
+	ShareIPC   bool     // share the ipc namespace with tasks of the allocation
+
+	// tcp ports the task may bind and connect to (optional)
+	Ports *landlock.Ports
+
+	// promises of programs executed by the command (optional)
+	ExecPromises string
+
+	// report the system calls denied by the native sandbox on stderr
+	Report bool
+
+	// out of memory handling
+	OOMScoreAdj *int // oom_score_adj of every process of the task (optional)
+	OOMGroup    bool // kill every process of the task together on oom
+
+	// environment policies from the plugin and task configuration
+	EnvPolicies []*EnvPolicy
+
+	// escalation policy for stopping the task
+	StopSteps  []Step
+	StopFreeze bool // freeze the cgroup before the final kill
+}
+
+// Step of a stop escalation policy, where Signal is sent to the task, which
+// then has up to Timeout to exit before the next step.
+type Step struct {
+	Signal  string
+	Timeout time.Duration
 }
@@ -0,0 +1,81 @@
+package pledge
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Rendering describes how a command would be sandboxed, without starting it.
+type Rendering struct {
+	// Args is the command line of the sandbox, from the first process
+	// cloned into the task cgroup to the command itself
+	Args []string `json:"args"`
+
+	// Env is the environment of the sandbox after sanitisation, sorted, with
+	// the values of redacted variables masked
+	Env []string `json:"env"`
+
+	// Cgroup is the writes to the files of the task cgroup, in order
+	Cgroup []CgroupWrite `json:"cgroup"`
+
+	// Unveil is the effective unveil rules of the command, including the
+	// private tmp directory
+	Unveil []string `json:"unveil"`
+
+	// Root is the private root emulating unveil with a mount namespace, if
+	// landlock is not used to enforce the unveil rules
+	Root string `json:"root,omitempty"`
+}
+
+// Render how the command of opts would be sandboxed by the pledge executable
+// bin in env, which is neither modified nor started.
+func Render(bin string, env *Environment, opts *Options) (*Rendering, error) {
+	e := &exe{bin: bin, env: env, opts: opts}
+	return e.Render()
+}
+
+func (e *exe) Render() (*Rendering, error) {
+	if e.recovered {
+		return nil, errors.New("cannot render the sandbox of a recovered command")
+	}
+	env, opts := e.env, e.opts
+
+	cred, err := e.credential()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render command without user: %w", err)
+	}
+
+	environment := flatten(cred.Name, cred.Home, env.Tmp, env.Env, opts.EnvPolicies)
+	variables := make([]string, 0, len(environment))
+	for k, v := range masked(environment, opts.EnvPolicies) {
+		variables = append(variables, k+"="+v)
+	}
+	sort.Strings(variables)
+
+	r := &Rendering{
+		Args:   e.parameters(cred),
+		Env:    variables,
+		Cgroup: e.cgroupWrites(),
+		Unveil: e.unveil(),
+	}
+	if len(r.Unveil) > 0 && env.Init != "" {
+		r.Root = env.Root
+	}
+	return r, nil
+}
+
+// Quote joins args into a command line, quoting the arguments that would not
+// survive being split on spaces.
+func Quote(args ...string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,55 @@
+package pledge
+
+import (
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestRender(t *testing.T) {
+	env, _, _ := testEnv()
+	env.Tmp = "/alloc/task/tmp/pledge"
+	env.Env = map[string]string{"GREETING": "hello", "TOKEN": "secret", "LS_COLORS": "rs=0"}
+	env.Memory = 256 * 1024 * 1024
+	env.Bandwidth = 50000
+
+	opts := testOpts()
+	opts.Unveil = []string{"r:/etc"}
+	opts.OOMGroup = true
+	opts.EnvPolicies = []*EnvPolicy{{Redact: []string{"TOKEN"}}}
+
+	r, err := Render("/opt/bin/pledge.com", env, opts)
+	must.NoError(t, err)
+
+	must.Eq(t, "unshare", r.Args[0])
+	must.Eq(t, []string{"--", "echo", "hello", "world"}, r.Args[len(r.Args)-4:])
+	must.Eq(t, []string{
+		"GREETING=hello",
+		"TMPDIR=/alloc/task/tmp/pledge",
+		"TOKEN=" + Redacted,
+	}, r.Env)
+	must.Eq(t, []CgroupWrite{
+		{File: "cpu.max", Content: "50000 100000"},
+		{File: "memory.max", Content: "268435456"},
+		{File: "cpu.weight.nice", Content: "10"},
+		{File: "memory.oom.group", Content: "1", Required: true},
+	}, r.Cgroup)
+	must.Eq(t, []string{"r:/etc", "rwc:/alloc/task/tmp/pledge"}, r.Unveil)
+	must.Eq(t, "", r.Root)
+
+	// rendering does not modify the options
+	must.Eq(t, []string{"r:/etc"}, opts.Unveil)
+}
+
+func TestRender_recovered(t *testing.T) {
+	env, _, _ := testEnv()
+	e := &exe{env: env, opts: testOpts(), recovered: true}
+	_, err := e.Render()
+	must.ErrorContains(t, err, "recovered")
+}
+
+func TestQuote(t *testing.T) {
+	must.Eq(t, `sh -c "echo hi" ""`, Quote("sh", "-c", "echo hi", ""))
+	must.Eq(t, `"it's"`, Quote("it's"))
+	must.Eq(t, "", Quote())
+}
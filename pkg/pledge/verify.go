@@ -0,0 +1,102 @@
+package pledge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseDigest returns the lowercase hex encoding of the sha256 digest, which
+// may be prefixed with "sha256:".
+func ParseDigest(digest string) (string, error) {
+	d := strings.ToLower(strings.TrimPrefix(digest, "sha256:"))
+	if _, err := hex.DecodeString(d); err != nil || len(d) != sha256.Size*2 {
+		return "", fmt.Errorf("sha256 digest %q must be %d hex characters", digest, sha256.Size*2)
+	}
+	return d, nil
+}
+
+// Verify that the sha256 digest of the file at path matches the given hex
+// encoded digest. An empty digest is always considered a match.
+func Verify(path, digest string) error {
+	if digest == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %q for verification: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to read %q for verification: %w", path, err)
+	}
+	return match(path, h.Sum(nil), digest)
+}
+
+// match the sha256 sum of the file at path against the expected digest.
+func match(path string, sum []byte, digest string) error {
+	actual := hex.EncodeToString(sum)
+	expected := strings.ToLower(strings.TrimPrefix(digest, "sha256:"))
+	if actual != expected {
+		return fmt.Errorf("sha256 digest of %q is %s, expected %s", path, actual, expected)
+	}
+	return nil
+}
+
+// Install a verified copy of the executable at path into dir, returning the
+// path of the copy. The digest is computed over the bytes being copied, so
+// replacing the file at path after it is verified does not change what gets
+// executed. The copy is named after its digest and reused while it still
+// matches. If digest is empty there is nothing to verify, and path itself is
+// returned. The dir must not be writable by anyone but the plugin.
+func Install(path, digest, dir string) (string, error) {
+	if digest == "" {
+		return path, nil
+	}
+	d, err := ParseDigest(digest)
+	if err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(dir, d)
+	if Verify(target, d) == nil {
+		return target, nil
+	}
+
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory for verified executables: %w", err)
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %q for verification: %w", path, err)
+	}
+	defer func() { _ = src.Close() }()
+
+	tmp, err := os.CreateTemp(dir, ".install-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create copy of %q: %w", path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(h, tmp), src)
+	err = errors.Join(err, tmp.Chmod(0o755), tmp.Close())
+	if err != nil {
+		return "", fmt.Errorf("failed to copy %q: %w", path, err)
+	}
+	if err = match(path, h.Sum(nil), d); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return "", fmt.Errorf("failed to install copy of %q: %w", path, err)
+	}
+	return target, nil
+}
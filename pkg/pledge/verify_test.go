@@ -0,0 +1,71 @@
+package pledge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pledge.com")
+	must.NoError(t, os.WriteFile(path, []byte("hello"), 0o755))
+
+	const digest = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	must.NoError(t, Verify(path, ""))
+	must.NoError(t, Verify(path, digest))
+	must.NoError(t, Verify(path, "sha256:"+digest))
+	must.ErrorContains(t, Verify(path, "abc123"), "expected abc123")
+	must.Error(t, Verify(filepath.Join(t.TempDir(), "missing"), digest))
+}
+
+func TestParseDigest(t *testing.T) {
+	const digest = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	d, err := ParseDigest("sha256:" + strings.ToUpper(digest))
+	must.NoError(t, err)
+	must.Eq(t, digest, d)
+
+	_, err = ParseDigest("abc123")
+	must.ErrorContains(t, err, "must be 64 hex characters")
+	_, err = ParseDigest(strings.Replace(digest, "2", "g", 1))
+	must.Error(t, err)
+}
+
+func TestInstall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pledge.com")
+	must.NoError(t, os.WriteFile(path, []byte("hello"), 0o755))
+	dir := filepath.Join(t.TempDir(), "bin")
+
+	const digest = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	// nothing to verify without a digest
+	installed, err := Install(path, "", dir)
+	must.NoError(t, err)
+	must.Eq(t, path, installed)
+
+	// the copy is what gets executed, whatever happens to the original
+	installed, err = Install(path, digest, dir)
+	must.NoError(t, err)
+	must.Eq(t, filepath.Join(dir, digest), installed)
+	must.NoError(t, os.WriteFile(path, []byte("evil"), 0o755))
+	b, err := os.ReadFile(installed)
+	must.NoError(t, err)
+	must.Eq(t, "hello", string(b))
+
+	// the copy is reused while it matches
+	again, err := Install(path, digest, dir)
+	must.NoError(t, err)
+	must.Eq(t, installed, again)
+
+	// a mismatch leaves nothing behind
+	must.NoError(t, os.Remove(installed))
+	_, err = Install(path, digest, dir)
+	must.ErrorContains(t, err, "expected "+digest)
+	entries, err := os.ReadDir(dir)
+	must.NoError(t, err)
+	must.SliceEmpty(t, entries)
+}
@@ -1,13 +1,18 @@
 package plugin
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/hashicorp/nomad/nomad/structs"
 	"github.com/hashicorp/nomad/plugins/base"
 	"github.com/hashicorp/nomad/plugins/drivers"
 	"github.com/hashicorp/nomad/plugins/shared/hclspec"
 	"github.com/shoenig/nomad-pledge/pkg/pledge"
 	"github.com/shoenig/nomad-pledge/pkg/resources"
+	"github.com/shoenig/nomad-pledge/pkg/resources/process"
+	"github.com/shoenig/nomad-pledge/pkg/sandbox"
 )
 
 const (
@@ -31,7 +36,50 @@ var info = &base.PluginInfoResponse{
 }
 
 var driverConfigSpec = hclspec.NewObject(map[string]*hclspec.Spec{
-	"pledge_executable": hclspec.NewAttr("pledge_executable", "string", true),
+	"backend":            hclspec.NewDefault(hclspec.NewAttr("backend", "string", false), hclspec.NewLiteral(`"pledge"`)),
+	"pledge_executable":  hclspec.NewAttr("pledge_executable", "string", false),
+	"pledge_sha256":      hclspec.NewAttr("pledge_sha256", "string", false),
+	"pledge_executables": hclspec.NewAttr("pledge_executables", "map(string)", false),
+	"pledge_checksums":   hclspec.NewAttr("pledge_checksums", "map(string)", false),
+	"allow_caps":         hclspec.NewAttr("allow_caps", "list(string)", false),
+	"allow_groups":       hclspec.NewAttr("allow_groups", "list(string)", false),
+	"allow_root":         hclspec.NewDefault(hclspec.NewAttr("allow_root", "bool", false), hclspec.NewLiteral("true")),
+	"default_user":       hclspec.NewAttr("default_user", "string", false),
+	"denied_host_uids":   hclspec.NewAttr("denied_host_uids", "string", false),
+	"denied_host_gids":   hclspec.NewAttr("denied_host_gids", "string", false),
+	"unveil_fallback":    hclspec.NewDefault(hclspec.NewAttr("unveil_fallback", "string", false), hclspec.NewLiteral(`"refuse"`)),
+	"data_dir":           hclspec.NewDefault(hclspec.NewAttr("data_dir", "string", false), hclspec.NewLiteral(`"/run/nomad-pledge"`)),
+	"env_allow":          hclspec.NewAttr("env_allow", "list(string)", false),
+	"env_deny":           hclspec.NewAttr("env_deny", "list(string)", false),
+	"env_redact":         hclspec.NewAttr("env_redact", "list(string)", false),
+	"user_namespace": hclspec.NewBlock("user_namespace", false, hclspec.NewObject(map[string]*hclspec.Spec{
+		"start": hclspec.NewAttr("start", "number", true),
+		"size":  hclspec.NewDefault(hclspec.NewAttr("size", "number", false), hclspec.NewLiteral("65536")),
+		"count": hclspec.NewDefault(hclspec.NewAttr("count", "number", false), hclspec.NewLiteral("1024")),
+	})),
+	"dynamic_user": hclspec.NewBlock("dynamic_user", false, hclspec.NewObject(map[string]*hclspec.Spec{
+		"start": hclspec.NewAttr("start", "number", true),
+		"count": hclspec.NewDefault(hclspec.NewAttr("count", "number", false), hclspec.NewLiteral("1024")),
+	})),
+	"oom_score_adj": hclspec.NewBlock("oom_score_adj", false, hclspec.NewObject(map[string]*hclspec.Spec{
+		"min": hclspec.NewDefault(hclspec.NewAttr("min", "number", false), hclspec.NewLiteral("0")),
+		"max": hclspec.NewDefault(hclspec.NewAttr("max", "number", false), hclspec.NewLiteral("1000")),
+	})),
+	"allow_nice": hclspec.NewBlock("allow_nice", false, hclspec.NewObject(map[string]*hclspec.Spec{
+		"min": hclspec.NewDefault(hclspec.NewAttr("min", "number", false), hclspec.NewLiteral("0")),
+		"max": hclspec.NewDefault(hclspec.NewAttr("max", "number", false), hclspec.NewLiteral("19")),
+	})),
+	"allow_io_weight": hclspec.NewBlock("allow_io_weight", false, hclspec.NewObject(map[string]*hclspec.Spec{
+		"min": hclspec.NewDefault(hclspec.NewAttr("min", "number", false), hclspec.NewLiteral("1")),
+		"max": hclspec.NewDefault(hclspec.NewAttr("max", "number", false), hclspec.NewLiteral("100")),
+	})),
+	"allow_sched_policies": hclspec.NewAttr("allow_sched_policies", "list(string)", false),
+	"importance": hclspec.NewBlockList("importance", hclspec.NewObject(map[string]*hclspec.Spec{
+		"label":        hclspec.NewAttr("label", "string", true),
+		"nice":         hclspec.NewAttr("nice", "number", false),
+		"io_weight":    hclspec.NewAttr("io_weight", "number", false),
+		"sched_policy": hclspec.NewAttr("sched_policy", "string", false),
+	})),
 })
 
 var taskConfigSpec = hclspec.NewObject(map[string]*hclspec.Spec{
@@ -40,6 +88,40 @@ var taskConfigSpec = hclspec.NewObject(map[string]*hclspec.Spec{
 	"promises":   hclspec.NewAttr("promises", "string", false),
 	"unveil":     hclspec.NewAttr("unveil", "list(string)", false),
 	"importance": hclspec.NewAttr("importance", "string", false),
+	"cap_add":    hclspec.NewAttr("cap_add", "list(string)", false),
+	"cap_drop":   hclspec.NewAttr("cap_drop", "list(string)", false),
+	"group":      hclspec.NewAttr("group", "string", false),
+
+	"nice":         hclspec.NewAttr("nice", "number", false),
+	"io_weight":    hclspec.NewAttr("io_weight", "number", false),
+	"sched_policy": hclspec.NewAttr("sched_policy", "string", false),
+
+	"exec_promises": hclspec.NewAttr("exec_promises", "string", false),
+
+	"user_namespace": hclspec.NewAttr("user_namespace", "bool", false),
+	"dynamic_user":   hclspec.NewAttr("dynamic_user", "bool", false),
+
+	"oom_score_adj":    hclspec.NewAttr("oom_score_adj", "number", false),
+	"memory_oom_group": hclspec.NewAttr("memory_oom_group", "bool", false),
+
+	"restrict_ports":      hclspec.NewAttr("restrict_ports", "bool", false),
+	"allow_bind_ports":    hclspec.NewAttr("allow_bind_ports", "list(string)", false),
+	"allow_connect_ports": hclspec.NewAttr("allow_connect_ports", "list(string)", false),
+
+	"pid_mode": hclspec.NewAttr("pid_mode", "string", false),
+	"ipc_mode": hclspec.NewAttr("ipc_mode", "string", false),
+
+	"pledge_version": hclspec.NewAttr("pledge_version", "string", false),
+
+	"env_allow":  hclspec.NewAttr("env_allow", "list(string)", false),
+	"env_deny":   hclspec.NewAttr("env_deny", "list(string)", false),
+	"env_redact": hclspec.NewAttr("env_redact", "list(string)", false),
+
+	"stop_step": hclspec.NewBlockList("stop_step", hclspec.NewObject(map[string]*hclspec.Spec{
+		"signal":  hclspec.NewAttr("signal", "string", true),
+		"timeout": hclspec.NewAttr("timeout", "string", true),
+	})),
+	"stop_freeze": hclspec.NewAttr("stop_freeze", "bool", false),
 })
 
 var capabilities = &drivers.Capabilities{
@@ -59,7 +141,121 @@ var capabilities = &drivers.Capabilities{
 // Config represents the pledge-driver plugin configuration that gets set in the
 // Nomad client configuration file.
 type Config struct {
-	PledgeExecutable string `codec:"pledge_executable"`
+	Backend            string            `codec:"backend"`
+	PledgeExecutable   string            `codec:"pledge_executable"`
+	PledgeSHA256       string            `codec:"pledge_sha256"`
+	PledgeExecutables  map[string]string `codec:"pledge_executables"`
+	PledgeChecksums    map[string]string `codec:"pledge_checksums"`
+	AllowCaps          []string          `codec:"allow_caps"`
+	AllowGroups        []string          `codec:"allow_groups"`
+	AllowRoot          bool              `codec:"allow_root"`
+	DefaultUser        string            `codec:"default_user"`
+	DeniedHostUIDs     string            `codec:"denied_host_uids"`
+	DeniedHostGIDs     string            `codec:"denied_host_gids"`
+	UnveilFallback     string            `codec:"unveil_fallback"`
+	DataDir            string            `codec:"data_dir"`
+	EnvAllow           []string          `codec:"env_allow"`
+	EnvDeny            []string          `codec:"env_deny"`
+	EnvRedact          []string          `codec:"env_redact"`
+	UserNamespace      *UserNamespace    `codec:"user_namespace"`
+	DynamicUser        *DynamicUser      `codec:"dynamic_user"`
+	OOMScoreAdj        *OOMScoreAdj      `codec:"oom_score_adj"`
+	AllowNice          *Range            `codec:"allow_nice"`
+	AllowIOWeight      *Range            `codec:"allow_io_weight"`
+	AllowSchedPolicies []string          `codec:"allow_sched_policies"`
+	Importance         []ImportanceLevel `codec:"importance"`
+}
+
+// ImportanceLevel represents the settings of an importance label, overriding
+// the defaults of the label with those that are set.
+type ImportanceLevel struct {
+	Label       string `codec:"label"`
+	Nice        *int   `codec:"nice"`
+	IOWeight    *int   `codec:"io_weight"`
+	SchedPolicy string `codec:"sched_policy"`
+}
+
+// UserNamespace represents the subordinate range of host uids and gids from
+// which each task running in a user namespace is allocated a block of ids.
+type UserNamespace struct {
+	Start uint32 `codec:"start"` // first host id of the subordinate range
+	Size  uint32 `codec:"size"`  // number of ids allocated per task
+	Count uint32 `codec:"count"` // maximum number of tasks
+}
+
+// DynamicUser represents the range of host ids from which each task running as
+// a dynamic user is allocated a uid, with a gid of the same value.
+type DynamicUser struct {
+	Start uint32 `codec:"start"` // first host id of the range
+	Count uint32 `codec:"count"` // maximum number of tasks
+}
+
+// defaultDataDir is where the plugin keeps the files it records about tasks,
+// which must not be writable by tasks
+const defaultDataDir = "/run/nomad-pledge"
+
+const (
+	// backendPledge enforces promises and unveil rules with the external
+	// pledge utility
+	backendPledge = "pledge"
+
+	// backendNative enforces promises and unveil rules with the plugin
+	// executable itself, using seccomp and Landlock
+	backendNative = "native"
+)
+
+const (
+	// fallbackRefuse fails to start tasks with unveil rules when landlock
+	// is unavailable
+	fallbackRefuse = "refuse"
+
+	// fallbackSeccomp starts tasks with unveil rules when landlock is
+	// unavailable, restricted by their promises alone
+	fallbackSeccomp = "seccomp"
+
+	// fallbackMount emulates the unveil rules of tasks with a private root
+	// filesystem in a mount namespace when landlock is unavailable
+	fallbackMount = "mount"
+)
+
+// native returns whether tasks are sandboxed by the plugin executable.
+func (c *Config) native() bool {
+	return c.Backend == backendNative
+}
+
+// levels returns the settings of each importance label, which are the defaults
+// overridden by the importance blocks of the plugin configuration.
+func (c *Config) levels() (resources.Levels, error) {
+	levels := resources.DefaultLevels()
+	for _, level := range c.Importance {
+		if err := levels.Set(level.Label, level.Nice, level.IOWeight, level.SchedPolicy); err != nil {
+			return nil, err
+		}
+	}
+	return levels, nil
+}
+
+// envPolicy returns the environment policy of the plugin configuration.
+func (c *Config) envPolicy() *pledge.EnvPolicy {
+	return &pledge.EnvPolicy{
+		Allow:  c.EnvAllow,
+		Deny:   c.EnvDeny,
+		Redact: c.EnvRedact,
+	}
+}
+
+// executable returns the path and expected sha256 digest of the pledge
+// executable with the given name, or of the default pledge executable if
+// name is empty. The digest is empty if no checksum is configured.
+func (c *Config) executable(name string) (string, string, error) {
+	if name == "" {
+		return c.PledgeExecutable, c.PledgeSHA256, nil
+	}
+	path, exists := c.PledgeExecutables[name]
+	if !exists {
+		return "", "", fmt.Errorf("pledge_version %q not found in pledge_executables", name)
+	}
+	return path, c.PledgeChecksums[name], nil
 }
 
 // TaskConfig represents the pledge-driver task configuration that gets set in
@@ -70,26 +266,192 @@ type TaskConfig struct {
 	Promises   string   `codec:"promises"`
 	Unveil     []string `codec:"unveil"`
 	Importance string   `codec:"importance"`
+	CapAdd     []string `codec:"cap_add"`
+	CapDrop    []string `codec:"cap_drop"`
+	Group      string   `codec:"group"`
+
+	Nice        *int   `codec:"nice"`
+	IOWeight    *int   `codec:"io_weight"`
+	SchedPolicy string `codec:"sched_policy"`
+
+	ExecPromises string `codec:"exec_promises"`
+
+	UserNamespace bool `codec:"user_namespace"`
+	DynamicUser   bool `codec:"dynamic_user"`
+
+	OOMScoreAdj    *int `codec:"oom_score_adj"`
+	MemoryOOMGroup bool `codec:"memory_oom_group"`
+
+	RestrictPorts     bool     `codec:"restrict_ports"`
+	AllowBindPorts    []string `codec:"allow_bind_ports"`
+	AllowConnectPorts []string `codec:"allow_connect_ports"`
+
+	PidMode string `codec:"pid_mode"`
+	IpcMode string `codec:"ipc_mode"`
+
+	PledgeVersion string `codec:"pledge_version"`
+
+	EnvAllow  []string `codec:"env_allow"`
+	EnvDeny   []string `codec:"env_deny"`
+	EnvRedact []string `codec:"env_redact"`
+
+	StopSteps  []StopStep `codec:"stop_step"`
+	StopFreeze bool       `codec:"stop_freeze"`
+}
+
+// StopStep represents one step of the stop escalation policy of a task.
+type StopStep struct {
+	Signal  string `codec:"signal"`
+	Timeout string `codec:"timeout"`
+}
+
+const (
+	// modePrivate gives a task namespaces of its own
+	modePrivate = "private"
+
+	// modeGroup shares namespaces across the tasks of an allocation
+	modeGroup = "group"
+)
+
+// checkMode validates a namespace mode, returning whether the namespace is
+// shared across the tasks of the allocation.
+func checkMode(option, mode string) (bool, error) {
+	switch mode {
+	case "", modePrivate:
+		return false, nil
+	case modeGroup:
+		return true, nil
+	default:
+		return false, fmt.Errorf("%s must be %q or %q, got %q", option, modePrivate, modeGroup, mode)
+	}
+}
+
+// checkStopSteps validates and converts the stop escalation policy of a task.
+func checkStopSteps(steps []StopStep) ([]pledge.Step, error) {
+	result := make([]pledge.Step, 0, len(steps))
+	for _, step := range steps {
+		if _, err := process.Parse(step.Signal); err != nil {
+			return nil, fmt.Errorf("invalid stop_step signal: %w", err)
+		}
+		timeout, err := time.ParseDuration(step.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stop_step timeout: %w", err)
+		}
+		if timeout <= 0 {
+			return nil, fmt.Errorf("stop_step timeout must be positive")
+		}
+		result = append(result, pledge.Step{Signal: step.Signal, Timeout: timeout})
+	}
+	return result, nil
 }
 
-func parseOptions(driverTaskConfig *drivers.TaskConfig) (*pledge.Options, error) {
+func parseOptions(driverTaskConfig *drivers.TaskConfig, config *Config) (*pledge.Options, error) {
 	var taskConfig TaskConfig
 	if err := driverTaskConfig.DecodeDriverConfig(&taskConfig); err != nil {
 		return nil, fmt.Errorf("failed to decode driver task config: %w", err)
 	}
-	importance, err := resources.ParseImportance(taskConfig.Importance)
+	levels, err := config.levels()
+	if err != nil {
+		return nil, fmt.Errorf("invalid plugin importance: %w", err)
+	}
+	importance, err := levels.Parse(taskConfig.Importance)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse task importance: %w", err)
 	}
+	if err = checkImportance(&taskConfig, config); err != nil {
+		return nil, fmt.Errorf("failed to parse task importance: %w", err)
+	}
+	if err = importance.Override(taskConfig.Nice, taskConfig.IOWeight, taskConfig.SchedPolicy); err != nil {
+		return nil, fmt.Errorf("failed to parse task importance: %w", err)
+	}
+	if err = checkPolicy(importance.Policy, config.AllowSchedPolicies); err != nil {
+		return nil, fmt.Errorf("failed to parse task importance: %w", err)
+	}
 	promises, err := checkPromises(taskConfig.Promises)
 	if err != nil {
 		return nil, fmt.Errorf("failed promise validations: %w", err)
 	}
+	execPromises, err := checkPromises(taskConfig.ExecPromises)
+	if err == nil {
+		err = sandbox.CheckExecPromises(execPromises)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed exec promise validations: %w", err)
+	}
+	taskPolicy := &pledge.EnvPolicy{
+		Allow:  taskConfig.EnvAllow,
+		Deny:   taskConfig.EnvDeny,
+		Redact: taskConfig.EnvRedact,
+	}
+	if err = taskPolicy.Validate(); err != nil {
+		return nil, fmt.Errorf("failed environment policy validations: %w", err)
+	}
+	if taskConfig.UserNamespace && config.UserNamespace == nil {
+		return nil, errors.New("user_namespace requires plugin user_namespace configuration")
+	}
+	if taskConfig.UserNamespace && taskConfig.Group != "" {
+		return nil, errors.New("group cannot be set when using user_namespace")
+	}
+	if taskConfig.DynamicUser && config.DynamicUser == nil {
+		return nil, errors.New("dynamic_user requires plugin dynamic_user configuration")
+	}
+	if taskConfig.DynamicUser && (taskConfig.UserNamespace || taskConfig.Group != "") {
+		return nil, errors.New("user_namespace and group cannot be set when using dynamic_user")
+	}
+	sharePID, err := checkMode("pid_mode", taskConfig.PidMode)
+	if err != nil {
+		return nil, err
+	}
+	shareIPC, err := checkMode("ipc_mode", taskConfig.IpcMode)
+	if err != nil {
+		return nil, err
+	}
+	if taskConfig.UserNamespace && (sharePID || shareIPC) {
+		return nil, errors.New("pid_mode and ipc_mode cannot be group when using user_namespace")
+	}
+	oomScoreAdj, err := checkOOMScoreAdj(taskConfig.OOMScoreAdj, config.OOMScoreAdj)
+	if err != nil {
+		return nil, err
+	}
+	stopSteps, err := checkStopSteps(taskConfig.StopSteps)
+	if err != nil {
+		return nil, fmt.Errorf("failed stop policy validations: %w", err)
+	}
+	var allocatedPorts *structs.AllocatedPorts
+	if driverTaskConfig.Resources != nil {
+		allocatedPorts = driverTaskConfig.Resources.Ports
+	}
+	ports, err := checkPorts(taskConfig.RestrictPorts, taskConfig.AllowBindPorts, taskConfig.AllowConnectPorts, allocatedPorts)
+	if err != nil {
+		return nil, fmt.Errorf("failed network rule validations: %w", err)
+	}
+	capAdd, capDrop, err := checkCapabilities(taskConfig.CapAdd, taskConfig.CapDrop, config.AllowCaps)
+	if err != nil {
+		return nil, fmt.Errorf("failed capability validations: %w", err)
+	}
 	return &pledge.Options{
-		Command:    taskConfig.Command,
-		Arguments:  taskConfig.Args,
-		Promises:   promises,
-		Unveil:     taskConfig.Unveil,
-		Importance: importance,
+		Command:      taskConfig.Command,
+		Arguments:    taskConfig.Args,
+		Promises:     promises,
+		ExecPromises: execPromises,
+		Unveil:       taskConfig.Unveil,
+		Importance:   importance,
+		CapAdd:       capAdd,
+		CapDrop:      capDrop,
+		Version:      taskConfig.PledgeVersion,
+		Group:        taskConfig.Group,
+		UserNS:       taskConfig.UserNamespace,
+		Dynamic:      taskConfig.DynamicUser,
+		SharePID:     sharePID,
+		ShareIPC:     shareIPC,
+		Ports:        ports,
+		OOMScoreAdj:  oomScoreAdj,
+		OOMGroup:     taskConfig.MemoryOOMGroup,
+		StopSteps:    stopSteps,
+		StopFreeze:   taskConfig.StopFreeze,
+		EnvPolicies: []*pledge.EnvPolicy{
+			config.envPolicy(),
+			taskPolicy,
+		},
 	}, nil
 }
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/go-set/v2"
+	"github.com/shoenig/nomad-pledge/pkg/caps"
+)
+
+// all is the keyword for dropping every capability
+const all = "all"
+
+// normalize returns the name of capability c as understood by setpriv,
+// e.g. "net_bind_service".
+func normalize(c string) (string, error) {
+	if strings.ToLower(c) == all {
+		return all, nil
+	}
+	n, err := caps.Parse(c)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(caps.Name(n), "cap_"), nil
+}
+
+// checkCapabilities validates the capabilities a task wants to add or drop,
+// making sure any added capability is in the allow-list of the plugin config.
+func checkCapabilities(add, drop, allowed []string) ([]string, []string, error) {
+	allow := set.New[string](len(allowed))
+	for _, c := range allowed {
+		n, err := normalize(c)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid allow_caps: %w", err)
+		}
+		allow.Insert(n)
+	}
+
+	adding := make([]string, 0, len(add))
+	for _, c := range add {
+		n, err := normalize(c)
+		switch {
+		case err != nil:
+			return nil, nil, fmt.Errorf("invalid cap_add: %w", err)
+		case n == all:
+			return nil, nil, fmt.Errorf("cap_add does not support %q", all)
+		case !allow.Contains(n):
+			return nil, nil, fmt.Errorf("capability %q not in allow_caps", n)
+		}
+		adding = append(adding, n)
+	}
+
+	dropping := make([]string, 0, len(drop))
+	for _, c := range drop {
+		n, err := normalize(c)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid cap_drop: %w", err)
+		}
+		if slices.Contains(adding, n) {
+			return nil, nil, fmt.Errorf("capability %q cannot be both added and dropped", n)
+		}
+		dropping = append(dropping, n)
+	}
+
+	return adding, dropping, nil
+}
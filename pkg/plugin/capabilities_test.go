@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestCapabilities_check(t *testing.T) {
+	allowed := []string{"CAP_NET_BIND_SERVICE", "net_raw"}
+
+	add, drop, err := checkCapabilities(
+		[]string{"cap_net_bind_service"},
+		[]string{"ALL"},
+		allowed,
+	)
+	must.NoError(t, err)
+	must.Eq(t, []string{"net_bind_service"}, add)
+	must.Eq(t, []string{"all"}, drop)
+}
+
+func TestCapabilities_check_notAllowed(t *testing.T) {
+	_, _, err := checkCapabilities([]string{"sys_admin"}, nil, []string{"net_raw"})
+	must.ErrorContains(t, err, `capability "sys_admin" not in allow_caps`)
+}
+
+func TestCapabilities_check_unknown(t *testing.T) {
+	_, _, err := checkCapabilities(nil, []string{"sys_bogus"}, nil)
+	must.ErrorContains(t, err, "invalid cap_drop")
+}
+
+func TestCapabilities_check_conflict(t *testing.T) {
+	_, _, err := checkCapabilities([]string{"net_raw"}, []string{"net_raw"}, []string{"net_raw"})
+	must.ErrorContains(t, err, "both added and dropped")
+}
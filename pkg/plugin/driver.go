@@ -5,10 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,8 +25,13 @@ import (
 	"github.com/hashicorp/nomad/plugins/drivers"
 	"github.com/hashicorp/nomad/plugins/shared/hclspec"
 	"github.com/hashicorp/nomad/plugins/shared/structs"
+	"github.com/shoenig/nomad-pledge/pkg/caps"
+	"github.com/shoenig/nomad-pledge/pkg/holder"
+	"github.com/shoenig/nomad-pledge/pkg/ids"
+	"github.com/shoenig/nomad-pledge/pkg/landlock"
 	"github.com/shoenig/nomad-pledge/pkg/pledge"
 	"github.com/shoenig/nomad-pledge/pkg/resources"
+	"github.com/shoenig/nomad-pledge/pkg/seccomp"
 	"github.com/shoenig/nomad-pledge/pkg/task"
 	"github.com/shoenig/nomad-pledge/pkg/util"
 	"golang.org/x/sys/unix"
@@ -50,6 +61,24 @@ type PledgeDriver struct {
 	// users looks up system users
 	users util.Users
 
+	// userns allocates host ids for tasks running in a user namespace
+	userns ids.Pool
+
+	// dynamic allocates host ids for tasks running as a dynamic user
+	dynamic ids.Pool
+
+	// deniedUIDs and deniedGIDs are the host ids tasks may not run with,
+	// parsed from the plugin configuration
+	deniedUIDs ids.Ranges
+	deniedGIDs ids.Ranges
+
+	// namespaces tracks the pid and ipc namespaces shared by allocations
+	namespaces *namespaces
+
+	// self is the plugin executable, which also runs as the supervisor and
+	// the init process of each task
+	self string
+
 	// logger will log to the Nomad agent
 	logger hclog.Logger
 }
@@ -57,15 +86,30 @@ type PledgeDriver struct {
 func New(log hclog.Logger) drivers.DriverPlugin {
 	ctx, cancel := context.WithCancel(context.Background())
 	logger := log.Named(Name)
-	return &PledgeDriver{
+	self, err := os.Executable()
+	if err != nil {
+		logger.Warn("failed to find plugin executable, tasks will run without supervisor or init", "error", err)
+	}
+	p := &PledgeDriver{
 		ctx:    ctx,
 		cancel: cancel,
 		events: eventer.NewEventer(ctx, logger),
 		config: new(Config),
 		tasks:  task.NewStore(),
 		users:  util.NewUsers(),
+		self:   self,
 		logger: logger,
 	}
+	p.namespaces = newNamespaces(
+		func() (int, error) { return holder.Start(p.self) },
+		func(pid int) bool { return holder.Is(p.self, pid) },
+		func(pid int) {
+			if err := holder.Stop(p.self, pid); err != nil {
+				p.logger.Warn("failed to stop namespace holder", "pid", pid, "error", err)
+			}
+		},
+	)
+	return p
 }
 
 func (p *PledgeDriver) PluginInfo() (*base.PluginInfoResponse, error) {
@@ -85,10 +129,143 @@ func (p *PledgeDriver) SetConfig(c *base.Config) error {
 	}
 
 	p.config = &config
-	if p.config.PledgeExecutable == "" {
+	switch p.config.Backend {
+	case "":
+		p.config.Backend = backendPledge
+	case backendPledge, backendNative:
+	default:
+		return fmt.Errorf("backend must be %q or %q, got %q", backendPledge, backendNative, p.config.Backend)
+	}
+	switch p.config.UnveilFallback {
+	case "":
+		p.config.UnveilFallback = fallbackRefuse
+	case fallbackRefuse, fallbackSeccomp, fallbackMount:
+	default:
+		return fmt.Errorf("unveil_fallback must be %q, %q, or %q, got %q",
+			fallbackRefuse, fallbackSeccomp, fallbackMount, p.config.UnveilFallback)
+	}
+	switch {
+	case p.config.DataDir == "":
+		p.config.DataDir = defaultDataDir
+	case !filepath.IsAbs(p.config.DataDir):
+		return fmt.Errorf("data_dir must be an absolute path, got %q", p.config.DataDir)
+	}
+	switch {
+	case p.config.UnveilFallback == fallbackMount && p.self == "":
+		return fmt.Errorf("unveil_fallback %q requires the plugin executable", fallbackMount)
+	case p.config.native() && p.self == "":
+		return fmt.Errorf("native backend requires the plugin executable")
+	case !p.config.native() && p.config.PledgeExecutable == "":
 		return fmt.Errorf("pledge_executable must be set")
 	}
 
+	for name, path := range p.config.PledgeExecutables {
+		switch {
+		case name == "":
+			return fmt.Errorf("pledge_executables names must not be empty")
+		case path == "":
+			return fmt.Errorf("pledge_executables path for %q must be set", name)
+		}
+	}
+
+	if ns := p.config.UserNamespace; ns != nil {
+		switch {
+		case ns.Start == 0:
+			return fmt.Errorf("user_namespace start must not be root")
+		case ns.Size == 0 || ns.Count == 0:
+			return fmt.Errorf("user_namespace size and count must be positive")
+		case uint64(ns.Start)+uint64(ns.Size)*uint64(ns.Count) > math.MaxUint32:
+			return fmt.Errorf("user_namespace range exceeds maximum id")
+		}
+		p.userns = ids.NewPool(ns.Start, ns.Size, ns.Count)
+	}
+
+	if du := p.config.DynamicUser; du != nil {
+		end := uint64(du.Start) + uint64(du.Count)
+		switch {
+		case du.Start == 0:
+			return fmt.Errorf("dynamic_user start must not be root")
+		case du.Count == 0:
+			return fmt.Errorf("dynamic_user count must be positive")
+		case end > math.MaxUint32:
+			return fmt.Errorf("dynamic_user range exceeds maximum id")
+		}
+		if ns := p.config.UserNamespace; ns != nil {
+			nsEnd := uint64(ns.Start) + uint64(ns.Size)*uint64(ns.Count)
+			if uint64(du.Start) < nsEnd && uint64(ns.Start) < end {
+				return fmt.Errorf("dynamic_user range overlaps user_namespace range")
+			}
+		}
+		p.dynamic = ids.NewPool(du.Start, 1, du.Count)
+	}
+
+	if o := p.config.OOMScoreAdj; o != nil {
+		if err := o.validate(); err != nil {
+			return err
+		}
+	}
+	if r := p.config.AllowNice; r != nil {
+		if err := r.validate("allow_nice", niceMin, niceMax); err != nil {
+			return err
+		}
+	}
+	if r := p.config.AllowIOWeight; r != nil {
+		if err := r.validate("allow_io_weight", ioWeightMin, ioWeightMax); err != nil {
+			return err
+		}
+	}
+	if err := validatePolicies(p.config.AllowSchedPolicies); err != nil {
+		return fmt.Errorf("invalid allow_sched_policies: %w", err)
+	}
+
+	deniedUIDs, err := ids.ParseRanges(p.config.DeniedHostUIDs)
+	if err != nil {
+		return fmt.Errorf("invalid denied_host_uids: %w", err)
+	}
+	deniedGIDs, err := ids.ParseRanges(p.config.DeniedHostGIDs)
+	if err != nil {
+		return fmt.Errorf("invalid denied_host_gids: %w", err)
+	}
+	p.deniedUIDs, p.deniedGIDs = deniedUIDs, deniedGIDs
+
+	// dynamic users are never checked against the denied ids when allocated,
+	// so their range must not overlap them
+	if du := p.config.DynamicUser; du != nil {
+		last := du.Start + du.Count - 1
+		switch {
+		case deniedUIDs.Overlaps(du.Start, last):
+			return fmt.Errorf("dynamic_user range overlaps denied_host_uids")
+		case deniedGIDs.Overlaps(du.Start, last):
+			return fmt.Errorf("dynamic_user range overlaps denied_host_gids")
+		}
+	}
+
+	if _, err := p.config.levels(); err != nil {
+		return fmt.Errorf("invalid importance: %w", err)
+	}
+
+	if err := p.config.envPolicy().Validate(); err != nil {
+		return fmt.Errorf("invalid environment policy: %w", err)
+	}
+
+	if d := p.config.PledgeSHA256; d != "" {
+		if _, err := pledge.ParseDigest(d); err != nil {
+			return fmt.Errorf("invalid pledge_sha256: %w", err)
+		}
+	}
+	for name, d := range p.config.PledgeChecksums {
+		if _, exists := p.config.PledgeExecutables[name]; !exists {
+			return fmt.Errorf("pledge_checksums name %q not found in pledge_executables", name)
+		}
+		if _, err := pledge.ParseDigest(d); err != nil {
+			return fmt.Errorf("invalid pledge_checksums %q: %w", name, err)
+		}
+	}
+
+	// the integrity of pledge executables is verified by the fingerprint,
+	// which marks the driver unhealthy on a mismatch, and again when starting
+	// each task, which executes a verified copy
+
 	return nil
 }
 
@@ -130,25 +307,23 @@ func (p *PledgeDriver) doFingerprint() *drivers.Fingerprint {
 	healthState := drivers.HealthStateHealthy
 	healthDescription := drivers.DriverHealthy
 
-	// inspect pledge.com binary path
-	abs, err := filepath.Abs(p.config.PledgeExecutable)
-	if err != nil {
-		return failure(drivers.HealthStateUndetected, "failed to detect absolute path of pledge executable")
+	// inspect the default pledge.com binary, or the kernel support for the
+	// native sandbox
+	inspect := func() (map[string]*structs.Attribute, bool, *drivers.Fingerprint) {
+		return p.inspect(p.config.PledgeExecutable, p.config.PledgeSHA256)
 	}
-
-	// inspect pledge.com binary
-	fi, err := os.Stat(abs)
-	switch {
-	case os.IsNotExist(err):
-		return failure(drivers.HealthStateUndetected, "pledge executable not found")
-	case err != nil:
-		return failure(drivers.HealthStateUnhealthy, "failed to stat pledge executable")
-	case fi.Mode()&0o111 == 0:
-		return failure(drivers.HealthStateUnhealthy, "pledge binary is not executable")
-	case !p.detect("pledge"):
-		return failure(drivers.HealthStateUnhealthy, "kernel too old")
-	case !p.detect("unveil"):
-		return failure(drivers.HealthStateHealthy, "kernel landlock not enabled")
+	if p.config.native() {
+		inspect = p.inspectNative
+	}
+	attributes, unveil, fp := inspect()
+	if fp != nil {
+		return fp
+	}
+	if !unveil {
+		healthDescription = fmt.Sprintf("kernel landlock not enabled, unveil_fallback is %s", p.config.UnveilFallback)
+		attributes["driver.pledge.unveil"] = structs.NewStringAttribute(p.config.UnveilFallback)
+	} else {
+		attributes["driver.pledge.unveil"] = structs.NewStringAttribute("landlock")
 	}
 
 	// inspect unshare binary
@@ -162,6 +337,17 @@ func (p *PledgeDriver) doFingerprint() *drivers.Fingerprint {
 		return failure(drivers.HealthStateUndetected, "unshare executable does not exist")
 	}
 
+	// inspect setpriv binary
+	sPath, sErr := exec.LookPath("setpriv")
+	switch {
+	case os.IsNotExist(sErr):
+		return failure(drivers.HealthStateUndetected, "setpriv executable not found")
+	case sErr != nil:
+		return failure(drivers.HealthStateUnhealthy, "failed to find setpriv executable")
+	case sPath == "":
+		return failure(drivers.HealthStateUndetected, "setpriv executable does not exist")
+	}
+
 	// inspect nsenter binary
 	nPath, nErr := exec.LookPath("nsenter")
 	switch {
@@ -173,19 +359,157 @@ func (p *PledgeDriver) doFingerprint() *drivers.Fingerprint {
 		return failure(drivers.HealthStateUndetected, "nsenter executable does not exist")
 	}
 
-	// inspect cap_net_bind_service configuration
-	// e.g. sudo setcap cap_net_bind_service+eip /opt/bin/pledge-1.8.com
-	netCap := p.getcap("cap_net_bind_service")
+	attributes["driver.pledge.os"] = structs.NewStringAttribute(runtime.GOOS)
+	attributes["driver.pledge.backend"] = structs.NewStringAttribute(p.config.Backend)
+	attributes["driver.pledge.landlock"] = structs.NewBoolAttribute(false)
+	attributes["driver.pledge.promises"] = structs.NewStringAttribute(promises())
+
+	// inspect choom and chrt, which are only needed by tasks setting
+	// oom_score_adj or the batch and idle scheduling policies
+	attributes["driver.pledge.choom"] = structs.NewBoolAttribute(available("choom"))
+	attributes["driver.pledge.chrt"] = structs.NewBoolAttribute(available("chrt"))
+
+	// inspect user namespace support, which requires the newuidmap and
+	// newgidmap helpers used by unshare
+	_, uidErr := exec.LookPath("newuidmap")
+	_, gidErr := exec.LookPath("newgidmap")
+	attributes["driver.pledge.userns"] = structs.NewBoolAttribute(
+		p.config.UserNamespace != nil && uidErr == nil && gidErr == nil,
+	)
+
+	// inspect landlock abi version
+	if abi, abiErr := landlock.ABI(); abiErr == nil {
+		attributes["driver.pledge.landlock"] = structs.NewBoolAttribute(true)
+		attributes["driver.pledge.landlock.abi"] = structs.NewIntAttribute(int64(abi), "")
+		attributes["driver.pledge.landlock.net"] = structs.NewBoolAttribute(abi >= landlock.NetABI)
+	}
+
+	// inspect available cgroup controllers
+	if controllers, cErr := resources.Controllers(); cErr == nil {
+		attributes["driver.pledge.cgroup.controllers"] = structs.NewStringAttribute(strings.Join(controllers, ","))
+		for _, controller := range controllers {
+			attributes["driver.pledge.cgroup.controller."+controller] = structs.NewBoolAttribute(true)
+		}
+	}
+
+	// inspect additional named pledge.com binaries, which do not affect the
+	// health of the driver as a whole, and are not used by the native backend
+	named := p.config.PledgeExecutables
+	if p.config.native() {
+		named = nil
+	}
+	for name, path := range named {
+		prefix := "driver.pledge.executable." + name + "."
+		attrs, _, efp := p.inspect(path, p.config.PledgeChecksums[name])
+		attributes[prefix+"healthy"] = structs.NewBoolAttribute(efp == nil)
+		for key, value := range attrs {
+			attributes[prefix+strings.TrimPrefix(key, "driver.pledge.")] = value
+		}
+	}
 
 	return &drivers.Fingerprint{
 		Health:            healthState,
 		HealthDescription: healthDescription,
-		Attributes: map[string]*structs.Attribute{
-			"driver.pledge.abs":          structs.NewStringAttribute(abs),
-			"driver.pledge.os":           structs.NewStringAttribute(runtime.GOOS),
-			"driver.pledge.cap.net_bind": structs.NewBoolAttribute(netCap),
-		},
+		Attributes:        attributes,
+	}
+}
+
+// available returns whether the executable with name can be found.
+func available(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// inspect the pledge.com binary at path, returning the attributes describing
+// the executable and whether unveil is supported. If the executable is not
+// usable or does not match the expected sha256 digest, the returned fingerprint
+// describes why.
+func (p *PledgeDriver) inspect(path, digest string) (map[string]*structs.Attribute, bool, *drivers.Fingerprint) {
+	// inspect pledge.com binary path
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, false, failure(drivers.HealthStateUndetected, "failed to detect absolute path of pledge executable")
+	}
+
+	// inspect pledge.com binary
+	fi, err := os.Stat(abs)
+	switch {
+	case os.IsNotExist(err):
+		return nil, false, failure(drivers.HealthStateUndetected, "pledge executable not found")
+	case err != nil:
+		return nil, false, failure(drivers.HealthStateUnhealthy, "failed to stat pledge executable")
+	case fi.Mode()&0o111 == 0:
+		return nil, false, failure(drivers.HealthStateUnhealthy, "pledge binary is not executable")
+	case pledge.Verify(abs, digest) != nil:
+		return nil, false, failure(drivers.HealthStateUnhealthy, "pledge binary failed integrity verification")
+	}
+
+	// inspect seccomp support as reported by the pledge executable, which is
+	// needed for promises
+	supported := p.detect(abs, "pledge")
+	if !supported {
+		return nil, false, unsupported()
+	}
+
+	// inspect landlock support, which is needed for unveil
+	unveil := p.detect(abs, "unveil")
+
+	// inspect file capabilities of pledge binary
+	// e.g. sudo setcap cap_net_bind_service+eip /opt/bin/pledge-1.8.com
+	fcaps, err := caps.FromFile(abs)
+	if err != nil {
+		p.logger.Warn("failed to read pledge executable capabilities", "error", err)
+		fcaps = new(caps.File)
+	}
+	netCap := fcaps.Permitted.Contains(caps.NetBindService) &&
+		fcaps.Effective.Contains(caps.NetBindService)
+
+	attributes := map[string]*structs.Attribute{
+		"driver.pledge.abs":           structs.NewStringAttribute(abs),
+		"driver.pledge.verified":      structs.NewBoolAttribute(digest != ""),
+		"driver.pledge.cap.net_bind":  structs.NewBoolAttribute(netCap),
+		"driver.pledge.cap.permitted": structs.NewStringAttribute(fcaps.Permitted.String()),
+		"driver.pledge.cap.effective": structs.NewStringAttribute(fcaps.Effective.String()),
+		"driver.pledge.kernel.pledge": structs.NewBoolAttribute(supported),
+		"driver.pledge.kernel.unveil": structs.NewBoolAttribute(unveil),
+	}
+
+	// inspect pledge utility version, as reported by its usage
+	if version := p.version(abs); version != "" {
+		attributes["driver.pledge.version"] = structs.NewStringAttribute(version)
+	}
+
+	return attributes, unveil, nil
+}
+
+// inspectNative returns the attributes describing kernel support for the
+// native sandbox, and whether unveil is supported. If seccomp filters are not
+// supported, the returned fingerprint describes why.
+func (p *PledgeDriver) inspectNative() (map[string]*structs.Attribute, bool, *drivers.Fingerprint) {
+	supported := seccomp.Supported()
+	if !supported {
+		return nil, false, unsupported()
+	}
+
+	_, abiErr := landlock.ABI()
+	unveil := abiErr == nil
+
+	attributes := map[string]*structs.Attribute{
+		"driver.pledge.abs":           structs.NewStringAttribute(p.self),
+		"driver.pledge.kernel.pledge": structs.NewBoolAttribute(supported),
+		"driver.pledge.kernel.unveil": structs.NewBoolAttribute(unveil),
+	}
+	return attributes, unveil, nil
+}
+
+// unsupported returns the fingerprint of a kernel without the seccomp support
+// needed for promises, which still reports the lack of support.
+func unsupported() *drivers.Fingerprint {
+	fp := failure(drivers.HealthStateUnhealthy, "kernel too old")
+	fp.Attributes = map[string]*structs.Attribute{
+		"driver.pledge.kernel.pledge": structs.NewBoolAttribute(false),
 	}
+	return fp
 }
 
 func failure(state drivers.HealthState, desc string) *drivers.Fingerprint {
@@ -197,27 +521,36 @@ func failure(state drivers.HealthState, desc string) *drivers.Fingerprint {
 
 const timeout = 3 * time.Second
 
-func (p *PledgeDriver) getcap(name string) bool {
+func (p *PledgeDriver) detect(bin, param string) bool {
 	ctx, cancel := util.Timeout(timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "getcap", p.config.PledgeExecutable)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return false
-	}
-
-	exp := fmt.Sprintf("%s=eip", name) // todo: robustness
-	return strings.Contains(string(out), exp)
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", strings.Join([]string{bin, "-T", param}, " "))
+	_ = cmd.Run() // just check the exit code, non-zero means undetected
+	return cmd.ProcessState.ExitCode() == 0
 }
 
-func (p *PledgeDriver) detect(param string) bool {
+// versionRe matches the version in the usage of the pledge utility, e.g.
+// "pledge.com v1.8"
+var versionRe = regexp.MustCompile(`\bv(\d+\.\d+(?:\.\d+)?)\b`)
+
+// version returns the version of the pledge utility bin, as reported by its
+// usage, or the empty string if it reports none.
+func (p *PledgeDriver) version(bin string) string {
 	ctx, cancel := util.Timeout(timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", strings.Join([]string{p.config.PledgeExecutable, "-T", param}, " "))
-	_ = cmd.Run() // just check the exit code, non-zero means undetected
-	return cmd.ProcessState.ExitCode() == 0
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", strings.Join([]string{bin, "-h"}, " "))
+	output, _ := cmd.CombinedOutput() // the usage may exit non-zero
+	return parseVersion(output)
+}
+
+// parseVersion returns the version in the usage of the pledge utility.
+func parseVersion(usage []byte) string {
+	if m := versionRe.FindSubmatch(usage); m != nil {
+		return string(m[1])
+	}
+	return ""
 }
 
 func open(stdout, stderr string) (io.WriteCloser, io.WriteCloser, error) {
@@ -245,15 +578,33 @@ func netns(c *drivers.TaskConfig) string {
 	}
 }
 
+// exitfile returns the path of the file the supervisor of the task records the
+// exit status of the task into, which is in the data_dir of the plugin so that
+// the task cannot write to it.
+func (p *PledgeDriver) exitfile(c *drivers.TaskConfig) string {
+	return filepath.Join(p.config.DataDir, "exit", url.PathEscape(c.ID))
+}
+
+// legacyExitfile returns the path of the exit status file of tasks started by
+// older versions of the plugin, which do not record the path in their state.
+func legacyExitfile(c *drivers.TaskConfig) string {
+	return filepath.Join(c.TaskDir().Dir, "private", "pledge.exit")
+}
+
+// rootdir returns the mount point of the private root emulating unveil.
+func rootdir(c *drivers.TaskConfig) string {
+	return filepath.Join(c.TaskDir().Dir, "private", "root")
+}
+
+// tmpdir returns the path of the private temporary directory of the task,
+// which the driver creates inside the tmp directory managed by Nomad.
+func tmpdir(c *drivers.TaskConfig) string {
+	return filepath.Join(c.TaskDir().Dir, "tmp", "pledge")
+}
+
 func (p *PledgeDriver) StartTask(config *drivers.TaskConfig) (*drivers.TaskHandle, *drivers.DriverNetwork, error) {
-	if config.User == "" {
-		current, _, _, err := p.users.Current()
-		if err != nil {
-			p.logger.Error("failed to lookup current user", "error", err)
-			return nil, nil, err
-		}
-		config.User = current
-		p.logger.Trace("no user set so using default", "name", current)
+	if err := p.defaultUser(config); err != nil {
+		return nil, nil, err
 	}
 
 	if _, exists := p.tasks.Get(config.ID); exists {
@@ -270,13 +621,140 @@ func (p *PledgeDriver) StartTask(config *drivers.TaskConfig) (*drivers.TaskHandl
 		return nil, nil, fmt.Errorf("failed to open log file(s): %w", err)
 	}
 
+	// create the environment for pledge
+	env, err := p.environment(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	env.Out = stdout
+	env.Err = stderr
+	env.Events = p.emitter(config)
+
+	opts, err := parseOptions(config, p.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.logger.Trace(
+		"pledge runner",
+		"version", opts.Version,
+		"group", opts.Group,
+		"cmd", opts.Command,
+		"args", opts.Arguments,
+		"promises", opts.Promises,
+		"exec_promises", opts.ExecPromises,
+		"unveil", opts.Unveil,
+		"importance", opts.Importance,
+		"cap_add", opts.CapAdd,
+		"cap_drop", opts.CapDrop,
+		"memory_oom_group", opts.OOMGroup,
+	)
+
+	bin, err := p.admit(config, env, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// execute a verified copy of the pledge executable, which cannot be
+	// replaced between its verification and its execution
+	if bin != "" {
+		if bin, err = p.install(bin, opts); err != nil {
+			p.logger.Error("failed to install verified pledge executable", "error", err)
+			return nil, nil, err
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(env.Exit), 0700); err != nil {
+		p.logger.Error("failed to create exit status directory", "error", err)
+		return nil, nil, fmt.Errorf("failed to create exit status directory: %w", err)
+	}
+
+	// allocate host ids for running in a user namespace
+	if opts.UserNS {
+		base, idErr := p.userns.Acquire(config.ID)
+		if idErr != nil {
+			p.logger.Error("failed to allocate user namespace ids", "error", idErr)
+			return nil, nil, fmt.Errorf("failed to allocate user namespace ids: %w", idErr)
+		}
+		env.UserNS = &pledge.IDMap{Host: base, Size: p.config.UserNamespace.Size}
+	}
+
+	// allocate a host id for running as a dynamic user, which owns the task
+	// directory
+	if opts.Dynamic {
+		id, idErr := p.dynamicUser(config)
+		if idErr != nil {
+			p.logger.Error("failed to allocate dynamic user", "error", idErr)
+			p.release(config.ID)
+			return nil, nil, fmt.Errorf("failed to allocate dynamic user: %w", idErr)
+		}
+		env.Dynamic = id
+		env.User = pledge.DynamicUser
+	}
+
+	runner, err := p.start(config, bin, env, opts)
+	if err != nil {
+		p.release(config.ID)
+		return nil, nil, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	h, started := task.NewHandle(runner, config)
+	state := &task.State{
+		PID:        runner.PID(),
+		ShimPID:    runner.ShimPID(),
+		TaskConfig: config,
+		StartedAt:  started,
+		UserNS:     env.UserNS,
+
+		DynamicUser: env.Dynamic,
+
+		Options: opts,
+
+		Exit: env.Exit,
+
+		Holder: max(env.PidJoin, env.IpcJoin),
+	}
+
+	if err = handle.SetDriverState(state); err != nil {
+		return nil, nil, fmt.Errorf("failed to set driver state: %w", err)
+	}
+
+	p.logger.Trace("tasks will set config for handle", "id", config.ID)
+	p.tasks.Set(config.ID, h)
+
+	return handle, nil, nil
+}
+
+// defaultUser sets the user of a task without one to the default_user of the
+// plugin, or else to the user running the plugin.
+func (p *PledgeDriver) defaultUser(config *drivers.TaskConfig) error {
+	switch {
+	case config.User != "":
+	case p.config.DefaultUser != "":
+		config.User = p.config.DefaultUser
+		p.logger.Trace("no user set so using default_user", "name", config.User)
+	default:
+		current, _, _, err := p.users.Current()
+		if err != nil {
+			p.logger.Error("failed to lookup current user", "error", err)
+			return err
+		}
+		config.User = current
+		p.logger.Trace("no user set so using default", "name", current)
+	}
+	return nil
+}
+
+// environment creates the environment of the sandbox of a task, without the
+// log handles or the receiver of task events.
+func (p *PledgeDriver) environment(config *drivers.TaskConfig) (*pledge.Environment, error) {
 	memory := uint64(config.Resources.NomadResources.Memory.MemoryMB) * 1024 * 1024
 	memoryMax := uint64(config.Resources.NomadResources.Memory.MemoryMaxMB) * 1024 * 1024
 
 	bandwidth, err := resources.Bandwidth(uint64(config.Resources.NomadResources.Cpu.CpuShares))
 	if err != nil {
 		p.logger.Error("failed to compute cpu bandwidth: %w", err)
-		return nil, nil, fmt.Errorf("failed to compute cpu bandwidth: %w", err)
+		return nil, fmt.Errorf("failed to compute cpu bandwidth: %w", err)
 	}
 
 	cpuset := config.Resources.LinuxResources.CpusetCpus
@@ -285,54 +763,161 @@ func (p *PledgeDriver) StartTask(config *drivers.TaskConfig) (*drivers.TaskHandl
 	// with cgroups v2 this is just the task cgroup
 	cgroup := config.Resources.LinuxResources.CpusetCgroupPath
 
-	// create the environment for pledge
 	env := &pledge.Environment{
-		Out:       stdout,
-		Err:       stderr,
 		Env:       config.Env,
 		Dir:       config.TaskDir().Dir,
+		Tmp:       tmpdir(config),
 		User:      config.User,
 		Cgroup:    cgroup,
 		Net:       netns(config),
 		Memory:    memory,
 		MemoryMax: memoryMax,
 		Bandwidth: bandwidth,
+		Shim:      p.self,
+		Init:      p.self,
+		Exit:      p.exitfile(config),
 	}
+	return env, nil
+}
 
-	opts, err := parseOptions(config)
-	if err != nil {
-		return nil, nil, err
+// admit enforces the policies of the plugin on a task, applying the
+// unveil_fallback if landlock is unavailable, and returns the pledge executable
+// of the task, which is empty when using the native backend.
+func (p *PledgeDriver) admit(config *drivers.TaskConfig, env *pledge.Environment, opts *pledge.Options) (string, error) {
+	if opts.Group != "" {
+		if err := p.checkGroup(config.User, opts.Group); err != nil {
+			p.logger.Error("task group not allowed", "user", config.User, "group", opts.Group, "error", err)
+			return "", err
+		}
 	}
 
-	p.logger.Trace(
-		"pledge runner",
-		"cmd", opts.Command,
-		"args", opts.Arguments,
-		"promises", opts.Promises,
-		"unveil", opts.Unveil,
-		"importance", opts.Importance,
-	)
+	// tasks in a user namespace or running as a dynamic user run as host ids
+	// allocated from the ranges of the plugin configuration
+	if !opts.UserNS && !opts.Dynamic {
+		if err := p.checkUser(config.User, opts.Group); err != nil {
+			p.logger.Error("task user not allowed", "user", config.User, "group", opts.Group, "error", err)
+			return "", err
+		}
+	}
 
-	runner := pledge.New(p.config.PledgeExecutable, env, opts)
-	if err = runner.Start(p.ctx); err != nil {
-		return nil, nil, fmt.Errorf("failed to start command: %w", err)
+	// the oom score is adjusted by choom
+	if opts.OOMScoreAdj != nil && !available("choom") {
+		p.logger.Error("choom executable not found")
+		return "", errors.New("oom_score_adj requires the choom executable")
 	}
 
-	h, started := task.NewHandle(runner, config)
-	state := &task.State{
-		PID:        runner.PID(),
-		TaskConfig: config,
-		StartedAt:  started,
+	// the batch and idle scheduling policies are applied by chrt
+	switch opts.Importance.Policy {
+	case resources.PolicyBatch, resources.PolicyIdle:
+		if !available("chrt") {
+			p.logger.Error("chrt executable not found")
+			return "", fmt.Errorf("sched_policy %s requires the chrt executable", opts.Importance.Policy)
+		}
 	}
 
-	if err = handle.SetDriverState(state); err != nil {
-		return nil, nil, fmt.Errorf("failed to set driver state: %w", err)
+	// landlock network rules need a recent enough kernel
+	if opts.Ports != nil {
+		if abi, abiErr := landlock.ABI(); abiErr != nil || abi < landlock.NetABI {
+			p.logger.Error("landlock network rules not supported", "abi", abi, "error", abiErr)
+			return "", fmt.Errorf("restricting ports requires landlock abi %d or later", landlock.NetABI)
+		}
 	}
 
-	p.logger.Trace("tasks will set config for handle", "id", config.ID)
-	p.tasks.Set(config.ID, h)
+	// unveil rules need landlock, or else the fallback of the plugin
+	if len(opts.Unveil) > 0 {
+		if _, abiErr := landlock.ABI(); abiErr != nil {
+			if err := p.fallback(config, env, opts); err != nil {
+				p.logger.Error("landlock not supported", "error", abiErr)
+				return "", err
+			}
+		}
+	}
 
-	return handle, nil, nil
+	return p.sandbox(env, opts)
+}
+
+// fallback applies the unveil_fallback of the plugin to a task with unveil
+// rules when landlock is unavailable, emitting a task event through env that
+// says how the unveil rules are handled.
+func (p *PledgeDriver) fallback(c *drivers.TaskConfig, env *pledge.Environment, opts *pledge.Options) error {
+	emit := env.Events
+	annotations := map[string]string{"unveil_fallback": p.config.UnveilFallback}
+	switch p.config.UnveilFallback {
+	case fallbackSeccomp:
+		emit("Landlock unavailable, unveil rules not enforced", annotations)
+		opts.Unveil = nil
+	case fallbackMount:
+		emit("Landlock unavailable, unveil rules emulated with a mount namespace", annotations)
+		env.Root = rootdir(c)
+	default:
+		emit("Landlock unavailable, task with unveil rules refused", annotations)
+		return errors.New("unveil requires landlock, which is not enabled")
+	}
+	return nil
+}
+
+// sandbox returns the pledge executable of the task, or sets up env for the
+// native sandbox when using the native backend, in which case the returned
+// executable is empty.
+func (p *PledgeDriver) sandbox(env *pledge.Environment, opts *pledge.Options) (string, error) {
+	if p.config.native() {
+		if opts.Version != "" {
+			return "", errors.New("pledge_version cannot be set with the native backend")
+		}
+		env.Sandbox = p.self
+		return "", nil
+	}
+
+	// the pledge utility applies the same promises to programs executed by
+	// the command
+	if opts.ExecPromises != "" {
+		return "", errors.New("exec_promises requires the native backend")
+	}
+
+	bin, digest, err := p.config.executable(opts.Version)
+	if err != nil {
+		return "", err
+	}
+
+	// re-verify the pledge executable has not been tampered with
+	if err = pledge.Verify(bin, digest); err != nil {
+		p.logger.Error("pledge executable failed integrity verification", "error", err)
+		return "", err
+	}
+	return bin, nil
+}
+
+// install a verified copy of the pledge executable bin of the task into the
+// data_dir, returning the path of the copy. The data_dir must be traversable
+// by tasks to execute the copy, but is not readable or writable by them.
+func (p *PledgeDriver) install(bin string, opts *pledge.Options) (string, error) {
+	_, digest, err := p.config.executable(opts.Version)
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		return bin, nil
+	}
+	if err = traversable(p.config.DataDir); err != nil {
+		return "", fmt.Errorf("failed to prepare data_dir: %w", err)
+	}
+	return pledge.Install(bin, digest, filepath.Join(p.config.DataDir, "bin"))
+}
+
+// traversable creates dir if necessary, and makes sure that anyone may
+// traverse it.
+func traversable(dir string) error {
+	if err := os.MkdirAll(dir, 0o711); err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if mode := info.Mode().Perm(); mode&0o011 != 0o011 {
+		return os.Chmod(dir, mode|0o011)
+	}
+	return nil
 }
 
 // RecoverTask will re-create the in-memory state of a task from a TaskHandle
@@ -361,20 +946,84 @@ func (p *PledgeDriver) RecoverTask(handle *drivers.TaskHandle) error {
 
 	// re-create the environment for pledge
 	env := &pledge.Environment{
-		Out:    util.NullCloser(nil),
-		Err:    util.NullCloser(nil),
-		Env:    handle.Config.Env,
-		Dir:    handle.Config.TaskDir().Dir,
-		User:   handle.Config.User,
-		Cgroup: cgroup,
+		Out:     util.NullCloser(nil),
+		Err:     util.NullCloser(nil),
+		Env:     handle.Config.Env,
+		Dir:     handle.Config.TaskDir().Dir,
+		Tmp:     tmpdir(handle.Config),
+		User:    handle.Config.User,
+		Cgroup:  cgroup,
+		UserNS:  taskState.UserNS,
+		Events:  p.emitter(taskState.TaskConfig),
+		Dynamic: taskState.DynamicUser,
+		Init:    p.self,
+		Exit:    taskState.Exit,
+	}
+	if env.Exit == "" {
+		env.Exit = legacyExitfile(handle.Config)
+	}
+
+	// tasks started by older versions of the plugin have no recorded options,
+	// which are then parsed again against the current plugin configuration
+	var err error
+	opts := taskState.Options
+	if opts == nil {
+		if opts, err = parseOptions(taskState.TaskConfig, p.config); err != nil {
+			return fmt.Errorf("failed to recover task options: %w", err)
+		}
 	}
 
-	runner := pledge.Recover(taskState.PID, env)
+	// reclaim the host ids of the task user namespace
+	if m := taskState.UserNS; m != nil && p.userns != nil {
+		if err = p.userns.Claim(taskState.TaskConfig.ID, m.Host); err != nil {
+			return fmt.Errorf("failed to recover user namespace ids: %w", err)
+		}
+	}
+
+	// reclaim the host id of the task dynamic user
+	if id := taskState.DynamicUser; id > 0 && p.dynamic != nil {
+		if err = p.dynamic.Claim(taskState.TaskConfig.ID, id); err != nil {
+			return fmt.Errorf("failed to recover dynamic user: %w", err)
+		}
+	}
+
+	runner := pledge.Recover(taskState.PID, taskState.ShimPID, env, opts)
 	recHandle := task.RecreateHandle(runner, taskState.TaskConfig, taskState.StartedAt)
 	p.tasks.Set(taskState.TaskConfig.ID, recHandle)
+
+	if taskState.Holder > 0 {
+		p.namespaces.adopt(taskState.TaskConfig.AllocID, taskState.TaskConfig.ID, taskState.Holder)
+	}
 	return nil
 }
 
+// start the command of the task, joining the namespaces the task shares with
+// the other tasks of its allocation.
+func (p *PledgeDriver) start(c *drivers.TaskConfig, bin string, env *pledge.Environment, opts *pledge.Options) (pledge.Exec, error) {
+	// tasks sharing namespaces join those of the holder of the allocation
+	if opts.SharePID || opts.ShareIPC {
+		if p.self == "" {
+			return nil, errors.New("sharing namespaces requires the plugin executable")
+		}
+		pid, err := p.namespaces.join(c.AllocID, c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start namespace holder: %w", err)
+		}
+		if opts.SharePID {
+			env.PidJoin = pid
+		}
+		if opts.ShareIPC {
+			env.IpcJoin = pid
+		}
+	}
+
+	runner := pledge.New(bin, env, opts)
+	if err := runner.Start(p.ctx); err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
+
 // WaitTask waits on the task to reach completion - whether by terminating
 // gracefully and setting an exit code or by being rudely interrupted.
 func (p *PledgeDriver) WaitTask(ctx context.Context, taskID string) (<-chan *drivers.ExitResult, error) {
@@ -409,6 +1058,16 @@ func (p *PledgeDriver) StopTask(taskID string, timeout time.Duration, signal str
 	return h.Stop(signal, timeout)
 }
 
+const (
+	// destroySignal is sent when force destroying a task, regardless of its
+	// stop policy
+	destroySignal = "sigabrt"
+
+	// destroyTimeout is how long to wait for a force destroyed task to exit,
+	// before killing its cgroup
+	destroyTimeout = 100 * time.Millisecond
+)
+
 func (p *PledgeDriver) DestroyTask(taskID string, force bool) error {
 	p.logger.Debug("destroy task", "id", taskID, "force", force)
 
@@ -423,19 +1082,99 @@ func (p *PledgeDriver) DestroyTask(taskID string, force bool) error {
 		case false:
 			err = errors.New("cannot destroy running task")
 		case true:
-			err = h.Stop("sigabrt", 100*time.Millisecond)
+			err = h.Kill(destroySignal, destroyTimeout)
 		}
 	}
 
+	// remove the private tmp directory of the task, and release any ids
+	// allocated to the task, unless it is still running
+	if err == nil {
+		if rmErr := os.RemoveAll(tmpdir(h.Config())); rmErr != nil {
+			p.logger.Warn("failed to remove private tmp directory", "id", taskID, "error", rmErr)
+		}
+		if rmErr := os.Remove(p.exitfile(h.Config())); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) {
+			p.logger.Warn("failed to remove exit status file", "id", taskID, "error", rmErr)
+		}
+		p.release(taskID)
+	}
+
 	p.tasks.Del(taskID)
 	return err
 }
 
+// release any host ids allocated to the task, and any namespaces the task
+// shares with its allocation.
+func (p *PledgeDriver) release(taskID string) {
+	if p.userns != nil {
+		p.userns.Release(taskID)
+	}
+	if p.dynamic != nil {
+		p.dynamic.Release(taskID)
+	}
+	p.namespaces.leave(taskID)
+}
+
+// dynamicUser allocates the host id of the dynamic user of the task, which is
+// both its uid and gid, and makes the dynamic user the owner of the files
+// placed in the task directory before the task starts. Ids belonging to a user
+// or group of the host are skipped, and stay reserved so they are not tried
+// again.
+func (p *PledgeDriver) dynamicUser(c *drivers.TaskConfig) (uint32, error) {
+	for {
+		id, err := p.dynamic.Acquire(c.ID)
+		if err != nil {
+			return 0, err
+		}
+
+		if owner := hostOwner(id); owner != "" {
+			p.logger.Warn("skipping dynamic user id in use by the host", "id", id, "owner", owner)
+			p.dynamic.Release(c.ID)
+			_ = p.dynamic.Claim("host:"+strconv.FormatUint(uint64(id), 10), id)
+			continue
+		}
+
+		if err = chownTaskDir(c, int(id)); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+}
+
+// hostOwner returns the user or group of the host with the given id, or the
+// empty string if the id is not in use. The id of a dynamic user must not
+// belong to any user or group of the host.
+func hostOwner(id uint32) string {
+	s := strconv.FormatUint(uint64(id), 10)
+	if u, err := user.LookupId(s); err == nil {
+		return "user " + u.Username
+	}
+	if g, err := user.LookupGroupId(s); err == nil {
+		return "group " + g.Name
+	}
+	return ""
+}
+
 func (p *PledgeDriver) InspectTask(taskID string) (*drivers.TaskStatus, error) {
-	p.logger.Trace("InspectTask enter")
+	p.logger.Trace("inspect task", "id", taskID)
 
-	// todo
-	return nil, fmt.Errorf("InspectTask not implemented")
+	h, exists := p.tasks.Get(taskID)
+	if !exists {
+		return nil, drivers.ErrTaskNotFound
+	}
+
+	// include the effective environment, with secrets masked
+	status := h.Status()
+	for key, value := range h.Environment() {
+		status.DriverAttributes["env."+key] = value
+	}
+
+	// and how the task is sandboxed, for review
+	if r, err := h.Render(); err == nil {
+		for key, value := range renderAttributes(r) {
+			status.DriverAttributes[key] = value
+		}
+	}
+	return status, nil
 }
 
 func (p *PledgeDriver) TaskStats(ctx context.Context, taskID string, interval time.Duration) (<-chan *drivers.TaskResourceUsage, error) {
@@ -487,21 +1226,24 @@ func (p *PledgeDriver) stats(ctx context.Context, ch chan<- *drivers.TaskResourc
 	}
 }
 
-func (p *PledgeDriver) TaskEvents(_ context.Context) (<-chan *drivers.TaskEvent, error) {
-	// is there any use for this?
-	// e.g.
-	//  d.eventer.EmitEvent(&drivers.TaskEvent{
-	//	  TaskID:    task.ID,
-	//	  AllocID:   task.AllocID,
-	//	  TaskName:  task.Name,
-	//	  Timestamp: time.Now(),
-	//	  Message:   "Downloading image",
-	//	  Annotations: map[string]string{
-	//	  		"image": dockerImageRef(repo, tag),
-	//	  },
-	//  })
-	ch := make(chan *drivers.TaskEvent, 1)
-	return ch, nil
+func (p *PledgeDriver) TaskEvents(ctx context.Context) (<-chan *drivers.TaskEvent, error) {
+	return p.events.TaskEvents(ctx)
+}
+
+// emitter creates a pledge.EventFunc for emitting events of the given task.
+func (p *PledgeDriver) emitter(c *drivers.TaskConfig) pledge.EventFunc {
+	return func(message string, annotations map[string]string) {
+		if err := p.events.EmitEvent(&drivers.TaskEvent{
+			TaskID:      c.ID,
+			AllocID:     c.AllocID,
+			TaskName:    c.Name,
+			Timestamp:   time.Now(),
+			Message:     message,
+			Annotations: annotations,
+		}); err != nil {
+			p.logger.Warn("failed to emit task event", "id", c.ID, "error", err)
+		}
+	}
 }
 
 func (p *PledgeDriver) SignalTask(taskID string, signal string) error {
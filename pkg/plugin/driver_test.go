@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/shoenig/test/must"
+)
+
+func TestDriver_exitfile(t *testing.T) {
+	p := New(hclog.NewNullLogger()).(*PledgeDriver)
+
+	c, err := ParseConfig("plugin.hcl", []byte(`pledge_executable = "/opt/bin/pledge.com"`))
+	must.NoError(t, err)
+	must.NoError(t, p.SetConfig(c))
+
+	// the task id cannot escape the data directory
+	task := &drivers.TaskConfig{ID: "abc123/../web/def456"}
+	must.Eq(t, "/run/nomad-pledge/exit/abc123%2F..%2Fweb%2Fdef456", p.exitfile(task))
+
+	c, err = ParseConfig("plugin.hcl", []byte(`
+pledge_executable = "/opt/bin/pledge.com"
+data_dir          = "data"
+`))
+	must.NoError(t, err)
+	must.ErrorContains(t, p.SetConfig(c), "data_dir must be an absolute path")
+}
+
+func TestDriver_parseVersion(t *testing.T) {
+	must.Eq(t, "1.8", parseVersion([]byte("pledge.com v1.8\ncopyright 2022 justine alexandra roberts tunney\n")))
+	must.Eq(t, "1.9.1", parseVersion([]byte("usage: pledge v1.9.1 [-hnN] PROG ARGS...")))
+	must.Eq(t, "", parseVersion([]byte("usage: pledge.com [-hnN] PROG ARGS...\n  -v [perm:]path  unveil")))
+}
+
+func TestDriver_SetConfig_digests(t *testing.T) {
+	p := New(hclog.NewNullLogger()).(*PledgeDriver)
+
+	c, err := ParseConfig("plugin.hcl", []byte(`
+pledge_executable = "/opt/bin/pledge.com"
+pledge_sha256     = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b982"
+`))
+	must.NoError(t, err)
+	must.ErrorContains(t, p.SetConfig(c), "invalid pledge_sha256")
+
+	c, err = ParseConfig("plugin.hcl", []byte(`
+pledge_executable  = "/opt/bin/pledge.com"
+pledge_executables = { old = "/opt/bin/pledge-1.7.com" }
+pledge_checksums   = { old = "sha256:xyz" }
+`))
+	must.NoError(t, err)
+	must.ErrorContains(t, p.SetConfig(c), `invalid pledge_checksums "old"`)
+}
+
+func TestDriver_SetConfig_dynamicUserDenied(t *testing.T) {
+	p := New(hclog.NewNullLogger()).(*PledgeDriver)
+
+	c, err := ParseConfig("plugin.hcl", []byte(`
+backend          = "native"
+denied_host_uids = "0,1000-1999"
+dynamic_user {
+  start = 1500
+  count = 1000
+}
+`))
+	must.NoError(t, err)
+	must.ErrorContains(t, p.SetConfig(c), "dynamic_user range overlaps denied_host_uids")
+
+	c, err = ParseConfig("plugin.hcl", []byte(`
+backend          = "native"
+denied_host_gids = "2499"
+dynamic_user {
+  start = 1500
+  count = 1000
+}
+`))
+	must.NoError(t, err)
+	must.ErrorContains(t, p.SetConfig(c), "dynamic_user range overlaps denied_host_gids")
+
+	c, err = ParseConfig("plugin.hcl", []byte(`
+backend          = "native"
+denied_host_uids = "0,1000-1499"
+denied_host_gids = "2500"
+dynamic_user {
+  start = 1500
+  count = 1000
+}
+`))
+	must.NoError(t, err)
+	must.NoError(t, p.SetConfig(c))
+}
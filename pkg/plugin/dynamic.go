@@ -0,0 +1,31 @@
+package plugin
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/nomad/plugins/drivers"
+)
+
+// chownTaskDir makes id the owner and group of everything in the local and
+// secrets directories of the task, e.g. artifacts and templates. The task
+// directory itself stays owned by root, so the task cannot replace the private
+// directory of the driver or the link to the alloc directory shared with other
+// tasks.
+func chownTaskDir(c *drivers.TaskConfig, id int) error {
+	dir := c.TaskDir()
+	for _, root := range []string{dir.LocalDir, dir.SecretsDir} {
+		err := filepath.WalkDir(root, func(path string, _ fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(path, id, id)
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to set owner of task directory: %w", err)
+		}
+	}
+	return nil
+}
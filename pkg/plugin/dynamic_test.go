@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/shoenig/nomad-pledge/pkg/ids"
+	"github.com/shoenig/test/must"
+)
+
+func TestDynamic_chownTaskDir(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	c := &drivers.TaskConfig{AllocDir: t.TempDir(), Name: "web"}
+	dir := c.TaskDir()
+	private := filepath.Join(dir.Dir, "private")
+	file := filepath.Join(dir.LocalDir, "config", "app.conf")
+	must.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+	must.NoError(t, os.WriteFile(file, []byte("x"), 0o644))
+	must.NoError(t, os.MkdirAll(private, 0o700))
+	must.NoError(t, os.MkdirAll(dir.SecretsDir, 0o700))
+
+	must.NoError(t, chownTaskDir(c, 70001))
+
+	owner := func(path string) uint32 {
+		info, err := os.Lstat(path)
+		must.NoError(t, err)
+		return info.Sys().(*syscall.Stat_t).Uid
+	}
+	must.Eq(t, 0, owner(dir.Dir))
+	must.Eq(t, 70001, owner(dir.LocalDir))
+	must.Eq(t, 70001, owner(file))
+	must.Eq(t, 70001, owner(dir.SecretsDir))
+	must.Eq(t, 0, owner(private))
+}
+
+func TestDynamic_dynamicUser(t *testing.T) {
+	if hostOwner(0) == "" {
+		t.Skip("requires a host user or group with id 0")
+	}
+
+	p := &PledgeDriver{
+		dynamic: ids.NewPool(0, 1, 100),
+		logger:  hclog.NewNullLogger(),
+	}
+
+	// ids in use by the host are skipped, rather than blocking every task
+	a := &drivers.TaskConfig{ID: "a", AllocDir: t.TempDir(), Name: "web"}
+	idA, err := p.dynamicUser(a)
+	must.NoError(t, err)
+	must.Positive(t, idA)
+	must.Eq(t, "", hostOwner(idA))
+
+	b := &drivers.TaskConfig{ID: "b", AllocDir: t.TempDir(), Name: "web"}
+	idB, err := p.dynamicUser(b)
+	must.NoError(t, err)
+	must.NotEq(t, idA, idB)
+	must.Eq(t, "", hostOwner(idB))
+
+	// skipped ids stay reserved for the host
+	must.ErrorContains(t, p.dynamic.Claim("c", 0), "already in use")
+}
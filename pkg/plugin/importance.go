@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shoenig/nomad-pledge/pkg/resources"
+)
+
+// bounds of the importance settings enforced by the kernel
+const (
+	niceMin     = -20
+	niceMax     = 19
+	ioWeightMin = 1
+	ioWeightMax = 10000
+)
+
+// Range represents the range of nice or io_weight values tasks may set to
+// override those of their importance. By default tasks may lower their own
+// priority below that of the normal importance, but not raise it.
+type Range struct {
+	Min int `codec:"min"`
+	Max int `codec:"max"`
+}
+
+// default ranges of the values tasks may set
+var (
+	defaultNice     = Range{Min: 0, Max: niceMax}
+	defaultIOWeight = Range{Min: ioWeightMin, Max: 100}
+)
+
+// validate the range of the plugin configuration against the bounds of the
+// kernel.
+func (r *Range) validate(name string, lower, upper int) error {
+	switch {
+	case r.Min < lower || r.Max > upper:
+		return fmt.Errorf("%s range must be within [%d, %d]", name, lower, upper)
+	case r.Min > r.Max:
+		return fmt.Errorf("%s min must not exceed max", name)
+	}
+	return nil
+}
+
+// checkRange validates the value a task sets against the range of the plugin
+// configuration, or the fallback range if none is configured.
+func checkRange(name string, value *int, policy *Range, fallback Range) error {
+	if value == nil {
+		return nil
+	}
+	if policy == nil {
+		policy = &fallback
+	}
+	if *value < policy.Min || *value > policy.Max {
+		return fmt.Errorf("%s %d not in allowed range [%d, %d]", name, *value, policy.Min, policy.Max)
+	}
+	return nil
+}
+
+// validatePolicies validates the scheduling policies of the plugin
+// configuration.
+func validatePolicies(policies []string) error {
+	for _, policy := range policies {
+		switch policy {
+		case resources.PolicyOther, resources.PolicyBatch, resources.PolicyIdle:
+		default:
+			return fmt.Errorf("scheduling policy of %q not recognized", policy)
+		}
+	}
+	return nil
+}
+
+// checkPolicy validates the effective scheduling policy of a task, whether set
+// by the task or by its importance label, against the policies of the plugin
+// configuration, where none configured allows all. Leaving the policy
+// unchanged is always allowed.
+func checkPolicy(policy string, allowed []string) error {
+	if policy == "" || len(allowed) == 0 {
+		return nil
+	}
+	policy = strings.ToLower(policy)
+	if !slices.Contains(allowed, policy) {
+		return fmt.Errorf("sched_policy %q not in allowed policies %v", policy, allowed)
+	}
+	return nil
+}
+
+// checkImportance validates the nice and io_weight a task overrides against
+// the ranges of the plugin configuration.
+func checkImportance(taskConfig *TaskConfig, config *Config) error {
+	if err := checkRange("nice", taskConfig.Nice, config.AllowNice, defaultNice); err != nil {
+		return err
+	}
+	return checkRange("io_weight", taskConfig.IOWeight, config.AllowIOWeight, defaultIOWeight)
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/shoenig/test/must"
+)
+
+func TestRange_validate(t *testing.T) {
+	must.NoError(t, (&Range{Min: 0, Max: 19}).validate("allow_nice", niceMin, niceMax))
+	must.NoError(t, (&Range{Min: -20, Max: -20}).validate("allow_nice", niceMin, niceMax))
+	must.Error(t, (&Range{Min: -21, Max: 0}).validate("allow_nice", niceMin, niceMax))
+	must.Error(t, (&Range{Min: 0, Max: 20}).validate("allow_nice", niceMin, niceMax))
+	must.ErrorContains(t, (&Range{Min: 500, Max: 100}).validate("allow_io_weight", ioWeightMin, ioWeightMax), "min must not exceed max")
+	must.Error(t, (&Range{Min: 0, Max: 100}).validate("allow_io_weight", ioWeightMin, ioWeightMax))
+}
+
+func TestCheckImportance(t *testing.T) {
+	config := new(Config)
+
+	// unset leaves the importance unchanged
+	must.NoError(t, checkImportance(&TaskConfig{}, config))
+
+	// default ranges only allow tasks to lower their priority
+	must.NoError(t, checkImportance(&TaskConfig{Nice: pointer.Of(19), IOWeight: pointer.Of(100)}, config))
+	must.ErrorContains(t, checkImportance(&TaskConfig{Nice: pointer.Of(-1)}, config), "nice -1 not in allowed range [0, 19]")
+	must.ErrorContains(t, checkImportance(&TaskConfig{IOWeight: pointer.Of(101)}, config), "io_weight 101 not in allowed range [1, 100]")
+
+	// configured ranges may raise the priority
+	config = &Config{
+		AllowNice:     &Range{Min: -10, Max: 10},
+		AllowIOWeight: &Range{Min: 50, Max: 500},
+	}
+	must.NoError(t, checkImportance(&TaskConfig{Nice: pointer.Of(-10), IOWeight: pointer.Of(500)}, config))
+	must.Error(t, checkImportance(&TaskConfig{Nice: pointer.Of(11)}, config))
+	must.Error(t, checkImportance(&TaskConfig{IOWeight: pointer.Of(10)}, config))
+}
+
+func TestCheckPolicy(t *testing.T) {
+	// none configured allows all
+	must.NoError(t, checkPolicy("idle", nil))
+
+	allowed := []string{"batch", "idle"}
+	must.NoError(t, checkPolicy("", allowed))
+	must.NoError(t, checkPolicy("IDLE", allowed))
+	must.ErrorContains(t, checkPolicy("other", allowed), `sched_policy "other" not in allowed policies`)
+}
+
+func TestValidatePolicies(t *testing.T) {
+	must.NoError(t, validatePolicies(nil))
+	must.NoError(t, validatePolicies([]string{"other", "batch", "idle"}))
+	must.ErrorContains(t, validatePolicies([]string{"fifo"}), `scheduling policy of "fifo" not recognized`)
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"sync"
+)
+
+// namespaces tracks the holder of the pid and ipc namespaces shared by the
+// tasks of each allocation, and the tasks sharing them. The holder is started
+// when the first task sharing a namespace starts, and stopped when the last of
+// them is destroyed, so the shared namespaces outlive any one task.
+//
+// The lock is held only while looking up or starting the holder and recording
+// the members, so that tasks of the same allocation starting concurrently do
+// not each start a holder of their own.
+type namespaces struct {
+	lock   sync.Mutex
+	start  func() (int, error) // starts a holder, returning its host pid
+	alive  func(pid int) bool  // whether the holder with pid is running
+	stop   func(pid int)       // stops the holder with pid
+	allocs map[string]*shared  // alloc id -> shared namespaces
+}
+
+// shared namespaces of an allocation
+type shared struct {
+	holder  int                 // host pid of the holder
+	members map[string]struct{} // ids of the tasks sharing the namespaces
+}
+
+func newNamespaces(start func() (int, error), alive func(int) bool, stop func(int)) *namespaces {
+	return &namespaces{
+		start:  start,
+		alive:  alive,
+		stop:   stop,
+		allocs: make(map[string]*shared),
+	}
+}
+
+// join records the task as a member of the namespaces shared by the
+// allocation, starting a holder if the allocation has none running, and
+// returns the host pid of the holder.
+func (n *namespaces) join(allocID, taskID string) (int, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	s := n.allocs[allocID]
+	if s == nil || !n.alive(s.holder) {
+		pid, err := n.start()
+		if err != nil {
+			return 0, err
+		}
+		s = &shared{holder: pid, members: make(map[string]struct{})}
+		n.allocs[allocID] = s
+	}
+	s.members[taskID] = struct{}{}
+	return s.holder, nil
+}
+
+// adopt records the recovered task as a member of the namespaces of the
+// holder with pid, if the holder is still running.
+func (n *namespaces) adopt(allocID, taskID string, pid int) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if !n.alive(pid) {
+		return
+	}
+	s := n.allocs[allocID]
+	if s == nil || s.holder != pid {
+		s = &shared{holder: pid, members: make(map[string]struct{})}
+		n.allocs[allocID] = s
+	}
+	s.members[taskID] = struct{}{}
+}
+
+// leave removes the task from the namespaces it shares, stopping the holder
+// once no task shares them anymore.
+func (n *namespaces) leave(taskID string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for allocID, s := range n.allocs {
+		if _, exists := s.members[taskID]; !exists {
+			continue
+		}
+		delete(s.members, taskID)
+		if len(s.members) == 0 {
+			n.stop(s.holder)
+			delete(n.allocs, allocID)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+// fakeHolders starts and stops fake holders with increasing pids.
+type fakeHolders struct {
+	next    int
+	running map[int]bool
+}
+
+func newFakeHolders() (*fakeHolders, *namespaces) {
+	f := &fakeHolders{next: 100, running: make(map[int]bool)}
+	n := newNamespaces(
+		func() (int, error) {
+			f.next++
+			f.running[f.next] = true
+			return f.next, nil
+		},
+		func(pid int) bool { return f.running[pid] },
+		func(pid int) { delete(f.running, pid) },
+	)
+	return f, n
+}
+
+func TestNamespaces_join(t *testing.T) {
+	f, n := newFakeHolders()
+
+	// the first task of an allocation starts the holder
+	pid, err := n.join("alloc1", "task1")
+	must.NoError(t, err)
+	must.Eq(t, 101, pid)
+
+	// later tasks join the same holder
+	pid, err = n.join("alloc1", "task2")
+	must.NoError(t, err)
+	must.Eq(t, 101, pid)
+
+	// other allocations have a holder of their own
+	pid, err = n.join("alloc2", "task3")
+	must.NoError(t, err)
+	must.Eq(t, 102, pid)
+
+	// a holder that is no longer running is replaced
+	delete(f.running, 101)
+	pid, err = n.join("alloc1", "task4")
+	must.NoError(t, err)
+	must.Eq(t, 103, pid)
+}
+
+func TestNamespaces_join_error(t *testing.T) {
+	n := newNamespaces(
+		func() (int, error) { return 0, errors.New("no holder") },
+		func(int) bool { return false },
+		func(int) {},
+	)
+	_, err := n.join("alloc1", "task1")
+	must.EqError(t, err, "no holder")
+	must.MapEmpty(t, n.allocs)
+}
+
+func TestNamespaces_leave(t *testing.T) {
+	f, n := newFakeHolders()
+
+	_, _ = n.join("alloc1", "task1")
+	_, _ = n.join("alloc1", "task2")
+
+	// the holder outlives the task that started it
+	n.leave("task1")
+	must.True(t, f.running[101])
+
+	// and is stopped once no task shares its namespaces
+	n.leave("task2")
+	must.False(t, f.running[101])
+	must.MapEmpty(t, n.allocs)
+}
+
+func TestNamespaces_adopt(t *testing.T) {
+	f, n := newFakeHolders()
+	f.running[50] = true
+
+	// recovered tasks rejoin a running holder
+	n.adopt("alloc1", "task1", 50)
+	pid, err := n.join("alloc1", "task2")
+	must.NoError(t, err)
+	must.Eq(t, 50, pid)
+
+	// but not one that is gone
+	n.adopt("alloc2", "task3", 60)
+	must.MapNotContainsKey(t, n.allocs, "alloc2")
+}
+
+func TestNamespaces_checkMode(t *testing.T) {
+	shared, err := checkMode("pid_mode", "")
+	must.NoError(t, err)
+	must.False(t, shared)
+
+	shared, err = checkMode("pid_mode", "private")
+	must.NoError(t, err)
+	must.False(t, shared)
+
+	shared, err = checkMode("pid_mode", "group")
+	must.NoError(t, err)
+	must.True(t, shared)
+
+	_, err = checkMode("ipc_mode", "host")
+	must.EqError(t, err, `ipc_mode must be "private" or "group", got "host"`)
+}
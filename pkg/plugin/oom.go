@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"fmt"
+)
+
+// bounds of oom_score_adj enforced by the kernel
+const (
+	oomScoreAdjMin = -1000
+	oomScoreAdjMax = 1000
+)
+
+// OOMScoreAdj represents the range of oom_score_adj values tasks may set. By
+// default tasks may make themselves more likely to be killed when the node
+// runs out of memory, but not protect themselves at the expense of others.
+type OOMScoreAdj struct {
+	Min int `codec:"min"`
+	Max int `codec:"max"`
+}
+
+// validate the range of oom_score_adj values of the plugin configuration.
+func (o *OOMScoreAdj) validate() error {
+	switch {
+	case o.Min < oomScoreAdjMin || o.Max > oomScoreAdjMax:
+		return fmt.Errorf("oom_score_adj range must be within [%d, %d]", oomScoreAdjMin, oomScoreAdjMax)
+	case o.Min > o.Max:
+		return fmt.Errorf("oom_score_adj min must not exceed max")
+	}
+	return nil
+}
+
+// checkOOMScoreAdj validates the oom_score_adj of a task against the range of
+// the plugin configuration, or the default range if none is configured. A nil
+// value leaves the oom_score_adj of the task unchanged.
+func checkOOMScoreAdj(value *int, policy *OOMScoreAdj) (*int, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if policy == nil {
+		policy = &OOMScoreAdj{Min: 0, Max: oomScoreAdjMax}
+	}
+	if *value < policy.Min || *value > policy.Max {
+		return nil, fmt.Errorf("oom_score_adj %d not in allowed range [%d, %d]", *value, policy.Min, policy.Max)
+	}
+	return value, nil
+}
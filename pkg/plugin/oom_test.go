@@ -0,0 +1,39 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/shoenig/test/must"
+)
+
+func TestOOMScoreAdj_validate(t *testing.T) {
+	must.NoError(t, (&OOMScoreAdj{Min: 0, Max: 1000}).validate())
+	must.NoError(t, (&OOMScoreAdj{Min: -1000, Max: 1000}).validate())
+	must.NoError(t, (&OOMScoreAdj{Min: 500, Max: 500}).validate())
+	must.Error(t, (&OOMScoreAdj{Min: -1001, Max: 0}).validate())
+	must.Error(t, (&OOMScoreAdj{Min: 0, Max: 1001}).validate())
+	must.Error(t, (&OOMScoreAdj{Min: 100, Max: 0}).validate())
+}
+
+func TestCheckOOMScoreAdj(t *testing.T) {
+	// unset leaves the task unchanged
+	result, err := checkOOMScoreAdj(nil, nil)
+	must.NoError(t, err)
+	must.Nil(t, result)
+
+	// default range only allows tasks to make themselves more likely victims
+	result, err = checkOOMScoreAdj(pointer.Of(500), nil)
+	must.NoError(t, err)
+	must.Eq(t, 500, *result)
+	_, err = checkOOMScoreAdj(pointer.Of(-1), nil)
+	must.ErrorContains(t, err, "not in allowed range [0, 1000]")
+
+	// configured range may protect tasks
+	policy := &OOMScoreAdj{Min: -500, Max: 500}
+	result, err = checkOOMScoreAdj(pointer.Of(-500), policy)
+	must.NoError(t, err)
+	must.Eq(t, -500, *result)
+	_, err = checkOOMScoreAdj(pointer.Of(501), policy)
+	must.Error(t, err)
+}
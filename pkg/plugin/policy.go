@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"fmt"
+	"os/user"
+	"slices"
+
+	"github.com/shoenig/nomad-pledge/pkg/ids"
+	"github.com/shoenig/nomad-pledge/pkg/pledge"
+)
+
+// checkGroup enforces the policy for a task of the given user selecting group
+// as its primary group.
+func (p *PledgeDriver) checkGroup(username, group string) error {
+	g, err := pledge.LookupGroup(group)
+	if err != nil {
+		return err
+	}
+	cred, err := pledge.Lookup(username, group)
+	if err != nil {
+		return err
+	}
+	return checkGroup(cred, g, p.config.AllowGroups)
+}
+
+// checkGroup enforces the policy for tasks selecting their primary group g,
+// given the credential of the task user with g as primary group. A group is
+// permitted if the task user is already a member of the group, or if the group
+// is listed in the allow_groups plugin configuration.
+func checkGroup(cred *pledge.Credential, g *user.Group, allowed []string) error {
+	if slices.Contains(allowed, g.Name) || slices.Contains(allowed, g.Gid) {
+		return nil
+	}
+
+	// the groups of a user include the primary group of the user
+	if slices.Contains(cred.Groups, cred.GID) {
+		return nil
+	}
+
+	return fmt.Errorf("user %q is not a member of group %q", cred.Name, g.Name)
+}
+
+// checkUser enforces the policy for the host user and groups a task of the
+// given user runs as, with group as its primary group if set.
+func (p *PledgeDriver) checkUser(username, group string) error {
+	cred, err := pledge.Lookup(username, group)
+	if err != nil {
+		return err
+	}
+	return checkUser(cred, p.config.AllowRoot, p.deniedUIDs, p.deniedGIDs)
+}
+
+// checkUser enforces the policy for the host user and groups of cred. The user
+// must not be root unless allow_root is set, and neither the uid of the user
+// nor the gid of any group the task would run with may be in the denied ranges
+// parsed from denied_host_uids and denied_host_gids of the plugin configuration.
+func checkUser(cred *pledge.Credential, allowRoot bool, deniedUIDs, deniedGIDs ids.Ranges) error {
+	switch {
+	case cred.UID == 0 && !allowRoot:
+		return fmt.Errorf("running tasks as root is not allowed")
+	case deniedUIDs.Contains(cred.UID):
+		return fmt.Errorf("uid %d of user %q is denied", cred.UID, cred.Name)
+	}
+
+	// the groups of a user include the primary group of the user, and the
+	// gid is that of the selected group if any
+	for _, gid := range append([]uint32{cred.GID}, cred.Groups...) {
+		if deniedGIDs.Contains(gid) {
+			return fmt.Errorf("gid %d of user %q is denied", gid, cred.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"os/user"
+	"testing"
+
+	"github.com/shoenig/nomad-pledge/pkg/ids"
+	"github.com/shoenig/nomad-pledge/pkg/pledge"
+	"github.com/shoenig/test/must"
+)
+
+func TestPolicy_checkGroup(t *testing.T) {
+	g := &user.Group{Gid: "1234", Name: "wheel"}
+
+	// member of group, as primary or supplementary group
+	cred := &pledge.Credential{Name: "alice", GID: 1234, Groups: []uint32{1234, 100}}
+	must.NoError(t, checkGroup(cred, g, nil))
+
+	// not a member, unless allowed by name or id
+	cred = &pledge.Credential{Name: "bob", GID: 1234, Groups: []uint32{100}}
+	must.ErrorContains(t, checkGroup(cred, g, nil), `user "bob" is not a member of group "wheel"`)
+	must.NoError(t, checkGroup(cred, g, []string{"wheel"}))
+	must.NoError(t, checkGroup(cred, g, []string{"1234"}))
+	must.ErrorContains(t, checkGroup(cred, g, []string{"other"}), "is not a member of group")
+}
+
+func TestPolicy_PledgeDriver_checkGroup(t *testing.T) {
+	p := &PledgeDriver{config: new(Config)}
+
+	// primary group of user
+	must.NoError(t, p.checkGroup("root", "root"))
+	must.NoError(t, p.checkGroup("root", "0"))
+
+	// no such group
+	must.ErrorContains(t, p.checkGroup("root", "doesnotexist"), `failed to find group "doesnotexist"`)
+}
+
+func TestPolicy_checkUser(t *testing.T) {
+	root := &pledge.Credential{Name: "root", UID: 0, GID: 0, Groups: []uint32{0}}
+	alice := &pledge.Credential{Name: "alice", UID: 1000, GID: 1000, Groups: []uint32{1000, 27}}
+
+	// root is allowed unless denied
+	must.NoError(t, checkUser(root, true, nil, nil))
+	must.ErrorContains(t, checkUser(root, false, nil, nil), "root is not allowed")
+
+	// denied uids
+	denied := ids.Ranges{{First: 0, Last: 999}}
+	must.NoError(t, checkUser(alice, false, denied, nil))
+	must.ErrorContains(t, checkUser(root, true, denied, nil), `uid 0 of user "root" is denied`)
+
+	// denied gids, as a supplementary group or the selected group
+	denied = ids.Ranges{{First: 27, Last: 27}}
+	must.NoError(t, checkUser(root, true, nil, denied))
+	must.ErrorContains(t, checkUser(alice, false, nil, denied), `gid 27 of user "alice" is denied`)
+	bob := &pledge.Credential{Name: "bob", UID: 1001, GID: 27, Groups: []uint32{1001}}
+	must.ErrorContains(t, checkUser(bob, false, nil, denied), `gid 27 of user "bob" is denied`)
+}
+
+func TestPolicy_PledgeDriver_checkUser(t *testing.T) {
+	p := &PledgeDriver{config: &Config{AllowRoot: true}}
+	must.NoError(t, p.checkUser("root", ""))
+
+	// no such user
+	must.ErrorContains(t, p.checkUser("doesnotexist", ""), "failed to find user")
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/shoenig/nomad-pledge/pkg/landlock"
+)
+
+// allocated returns the ports allocated to a task by Nomad, by label. The
+// port of a label is the one in NOMAD_PORT_<label>, i.e. the mapped port if
+// there is one.
+func allocated(ports *structs.AllocatedPorts) map[string]int {
+	result := make(map[string]int)
+	if ports == nil {
+		return result
+	}
+	for _, mapping := range *ports {
+		port := mapping.Value
+		if mapping.To > 0 {
+			port = mapping.To
+		}
+		result[mapping.Label] = port
+	}
+	return result
+}
+
+// resolvePorts converts a list of port numbers or labels of allocated ports
+// into sorted port numbers. A nil list resolves to every allocated port if
+// restrict is set, and otherwise to nil, leaving the ports unrestricted.
+func resolvePorts(option string, list []string, ports map[string]int, restrict bool) ([]int, error) {
+	if list == nil && !restrict {
+		return nil, nil
+	}
+	result := make([]int, 0, len(ports))
+	if list == nil {
+		for _, port := range ports {
+			result = append(result, port)
+		}
+	}
+	for _, entry := range list {
+		if port, exists := ports[entry]; exists {
+			result = append(result, port)
+			continue
+		}
+		port, err := strconv.Atoi(entry)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("%s entry %q is neither a port number nor an allocated port label", option, entry)
+		}
+		result = append(result, port)
+	}
+	slices.Sort(result)
+	return slices.Compact(result), nil
+}
+
+// checkPorts validates the Landlock network rules of a task, returning nil if
+// the task does not restrict its ports. Setting only one of bind and connect
+// leaves the other unrestricted, unless restrict is set.
+func checkPorts(restrict bool, bind, connect []string, ports *structs.AllocatedPorts) (*landlock.Ports, error) {
+	if !restrict && bind == nil && connect == nil {
+		return nil, nil
+	}
+	labels := allocated(ports)
+	allowBind, err := resolvePorts("allow_bind_ports", bind, labels, restrict)
+	if err != nil {
+		return nil, err
+	}
+	allowConnect, err := resolvePorts("allow_connect_ports", connect, labels, restrict)
+	if err != nil {
+		return nil, err
+	}
+	return &landlock.Ports{
+		Bind:    allowBind,
+		Connect: allowConnect,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/hashicorp/nomad/plugins/base"
+	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/shoenig/nomad-pledge/pkg/landlock"
+	"github.com/shoenig/test/must"
+)
+
+var testPorts = &structs.AllocatedPorts{
+	{Label: "http", Value: 25000},
+	{Label: "admin", Value: 25001, To: 9000},
+}
+
+func TestPorts_check_disabled(t *testing.T) {
+	ports, err := checkPorts(false, nil, nil, testPorts)
+	must.NoError(t, err)
+	must.Nil(t, ports)
+}
+
+func TestPorts_check_defaults(t *testing.T) {
+	ports, err := checkPorts(true, nil, nil, testPorts)
+	must.NoError(t, err)
+	must.Eq(t, &landlock.Ports{
+		Bind:    []int{9000, 25000},
+		Connect: []int{9000, 25000},
+	}, ports)
+}
+
+func TestPorts_check_explicit(t *testing.T) {
+	ports, err := checkPorts(false, []string{"http"}, []string{"5432", "443", "5432"}, testPorts)
+	must.NoError(t, err)
+	must.Eq(t, &landlock.Ports{
+		Bind:    []int{25000},
+		Connect: []int{443, 5432},
+	}, ports)
+}
+
+func TestPorts_check_bindOnly(t *testing.T) {
+	// connect is left unrestricted
+	ports, err := checkPorts(false, []string{"http"}, nil, testPorts)
+	must.NoError(t, err)
+	must.Eq(t, &landlock.Ports{Bind: []int{25000}}, ports)
+	must.Nil(t, ports.Connect)
+
+	// unless every port is restricted
+	ports, err = checkPorts(true, []string{"http"}, nil, testPorts)
+	must.NoError(t, err)
+	must.Eq(t, []int{9000, 25000}, ports.Connect)
+}
+
+func TestPorts_check_empty(t *testing.T) {
+	// an empty list denies every port
+	ports, err := checkPorts(false, []string{}, nil, testPorts)
+	must.NoError(t, err)
+	must.NotNil(t, ports.Bind)
+	must.SliceEmpty(t, ports.Bind)
+	must.Nil(t, ports.Connect)
+}
+
+func TestPorts_decode_empty(t *testing.T) {
+	// an explicit empty list survives decoding of the task configuration
+	c := new(drivers.TaskConfig)
+	must.NoError(t, ParseTaskConfig("task.hcl", []byte(`
+command          = "server"
+allow_bind_ports = []
+`), c))
+
+	var config TaskConfig
+	must.NoError(t, c.DecodeDriverConfig(&config))
+	must.NotNil(t, config.AllowBindPorts)
+	must.SliceEmpty(t, config.AllowBindPorts)
+	must.Nil(t, config.AllowConnectPorts)
+
+	// and of the task state
+	ports, err := checkPorts(config.RestrictPorts, config.AllowBindPorts, config.AllowConnectPorts, testPorts)
+	must.NoError(t, err)
+	var b []byte
+	must.NoError(t, base.MsgPackEncode(&b, ports))
+	var decoded landlock.Ports
+	must.NoError(t, base.MsgPackDecode(b, &decoded))
+	must.NotNil(t, decoded.Bind)
+	must.SliceEmpty(t, decoded.Bind)
+	must.Nil(t, decoded.Connect)
+}
+
+func TestPorts_check_invalid(t *testing.T) {
+	_, err := checkPorts(true, []string{"metrics"}, nil, testPorts)
+	must.EqError(t, err, `allow_bind_ports entry "metrics" is neither a port number nor an allocated port label`)
+
+	_, err = checkPorts(true, nil, []string{"70000"}, nil)
+	must.ErrorContains(t, err, "allow_connect_ports")
+}
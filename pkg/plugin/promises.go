@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/go-set/v2"
@@ -44,3 +45,10 @@ func checkPromises(s string) (string, error) {
 		return "", fmt.Errorf("rejecting promises [%s]", reject)
 	}
 }
+
+// promises returns the sorted list of acceptable promises, separated by spaces.
+func promises() string {
+	list := acceptable.Slice()
+	sort.Strings(list)
+	return strings.Join(list, " ")
+}
@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/nomad/helper/pluginutils/hclspecutils"
+	"github.com/hashicorp/nomad/plugins/base"
+	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/hashicorp/nomad/plugins/shared/hclspec"
+	"github.com/shoenig/nomad-pledge/pkg/pledge"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/msgpack"
+)
+
+// ParseConfig parses the plugin configuration in src, which is the body of the
+// config block of the plugin in HCL, or the equivalent JSON if filename ends
+// in .json, for use with SetConfig.
+func ParseConfig(filename string, src []byte) (*base.Config, error) {
+	val, err := decode(filename, src, driverConfigSpec)
+	if err != nil {
+		return nil, err
+	}
+	b, err := msgpack.Marshal(val, val.Type())
+	if err != nil {
+		return nil, err
+	}
+	return &base.Config{PluginConfig: b}, nil
+}
+
+// ParseTaskConfig parses the task configuration in src, which is the body of
+// the config block of a task in HCL, or the equivalent JSON if filename ends
+// in .json, into the driver configuration of c.
+func ParseTaskConfig(filename string, src []byte, c *drivers.TaskConfig) error {
+	val, err := decode(filename, src, taskConfigSpec)
+	if err != nil {
+		return err
+	}
+	return c.EncodeDriverConfig(val)
+}
+
+// decode src according to spec.
+func decode(filename string, src []byte, spec *hclspec.Spec) (cty.Value, error) {
+	decSpec, diags := hclspecutils.Convert(spec)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+
+	parser := hclparse.NewParser()
+	parse := parser.ParseHCL
+	if filepath.Ext(filename) == ".json" {
+		parse = parser.ParseJSON
+	}
+	file, diags := parse(src, filename)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+
+	val, diags := hcldec.Decode(file.Body, decSpec, nil)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	if val.IsNull() {
+		return cty.NilVal, errors.New("configuration is empty")
+	}
+	return val, nil
+}
+
+// Render how the task would be sandboxed by the plugin, without starting the
+// task or allocating anything for it. Ids that are allocated when a task
+// starts are rendered as the ids that would be allocated to it now, though
+// another task may be allocated them first. The events describe
+// how the plugin configuration changed the task, such as the unveil_fallback
+// being applied.
+func (p *PledgeDriver) Render(config *drivers.TaskConfig, events pledge.EventFunc) (*pledge.Rendering, error) {
+	if err := p.defaultUser(config); err != nil {
+		return nil, err
+	}
+
+	env, err := p.environment(config)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = func(string, map[string]string) {}
+	}
+	env.Events = events
+
+	opts, err := parseOptions(config, p.config)
+	if err != nil {
+		return nil, err
+	}
+
+	bin, err := p.admit(config, env, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.UserNS {
+		base, idErr := p.userns.Peek(func(uint32) bool { return true })
+		if idErr != nil {
+			return nil, fmt.Errorf("failed to allocate user namespace ids: %w", idErr)
+		}
+		env.UserNS = &pledge.IDMap{Host: base, Size: p.config.UserNamespace.Size}
+		events("User namespace ids are allocated when the task starts", map[string]string{
+			"host": strconv.FormatUint(uint64(env.UserNS.Host), 10),
+		})
+	}
+	if opts.Dynamic {
+		id, idErr := p.dynamic.Peek(func(id uint32) bool { return hostOwner(id) == "" })
+		if idErr != nil {
+			return nil, fmt.Errorf("failed to allocate dynamic user: %w", idErr)
+		}
+		env.Dynamic = id
+		env.User = pledge.DynamicUser
+		events("Dynamic user is allocated when the task starts", map[string]string{
+			"uid": strconv.FormatUint(uint64(env.Dynamic), 10),
+		})
+	}
+
+	return pledge.Render(bin, env, opts)
+}
+
+// renderAttributes returns the driver attributes describing the rendering of
+// the sandbox of a task, other than the environment.
+func renderAttributes(r *pledge.Rendering) map[string]string {
+	attributes := map[string]string{
+		"render.args":   pledge.Quote(r.Args...),
+		"render.unveil": pledge.Quote(r.Unveil...),
+	}
+	for _, w := range r.Cgroup {
+		attributes["render.cgroup."+w.File] = w.Content
+	}
+	if r.Root != "" {
+		attributes["render.root"] = r.Root
+	}
+	return attributes
+}
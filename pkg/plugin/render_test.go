@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/plugins/base"
+	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/shoenig/nomad-pledge/pkg/pledge"
+	"github.com/shoenig/test/must"
+)
+
+func TestRender_ParseTaskConfig(t *testing.T) {
+	hcl := `
+command = "cat"
+args    = ["/etc/hostname"]
+unveil  = ["r:/etc"]
+
+stop_step {
+  signal  = "SIGTERM"
+  timeout = "5s"
+}
+`
+	json := `{"command": "cat", "args": ["/etc/hostname"], "unveil": ["r:/etc"], "stop_step": [{"signal": "SIGTERM", "timeout": "5s"}]}`
+
+	for name, src := range map[string]string{"task.hcl": hcl, "task.json": json} {
+		c := new(drivers.TaskConfig)
+		must.NoError(t, ParseTaskConfig(name, []byte(src), c))
+
+		var tc TaskConfig
+		must.NoError(t, c.DecodeDriverConfig(&tc))
+		must.Eq(t, "cat", tc.Command)
+		must.Eq(t, []string{"/etc/hostname"}, tc.Args)
+		must.Eq(t, []string{"r:/etc"}, tc.Unveil)
+		must.Eq(t, []StopStep{{Signal: "SIGTERM", Timeout: "5s"}}, tc.StopSteps)
+	}
+
+	err := ParseTaskConfig("task.hcl", []byte(`args = ["x"]`), new(drivers.TaskConfig))
+	must.ErrorContains(t, err, "command")
+}
+
+func TestRender_ParseConfig(t *testing.T) {
+	c, err := ParseConfig("plugin.hcl", []byte(`pledge_executable = "/opt/bin/pledge.com"`))
+	must.NoError(t, err)
+
+	var config Config
+	must.NoError(t, base.MsgPackDecode(c.PluginConfig, &config))
+	must.Eq(t, "/opt/bin/pledge.com", config.PledgeExecutable)
+	must.Eq(t, backendPledge, config.Backend)
+	must.True(t, config.AllowRoot)
+	must.Eq(t, "/run/nomad-pledge", config.DataDir)
+}
+
+func TestRender_renderAttributes(t *testing.T) {
+	must.Eq(t, map[string]string{
+		"render.args":             `unshare -- sh -c "echo hi"`,
+		"render.unveil":           "r:/etc rwc:/tmp",
+		"render.cgroup.cpu.max":   "5000 100000",
+		"render.cgroup.io.weight": "default 50",
+	}, renderAttributes(&pledge.Rendering{
+		Args:   []string{"unshare", "--", "sh", "-c", "echo hi"},
+		Env:    []string{"TMPDIR=/tmp"},
+		Cgroup: []pledge.CgroupWrite{{File: "cpu.max", Content: "5000 100000"}, {File: "io.weight", Content: "default 50"}},
+		Unveil: []string{"r:/etc", "rwc:/tmp"},
+	}))
+}
@@ -0,0 +1,126 @@
+// Package reaper implements a minimal init process for the pid namespace of a
+// task.
+//
+// The init is the plugin executable re-invoked with the Command argument, and
+// runs as PID 1 of the pid namespace of the task, as the user and with the
+// capabilities of the task. It starts the workload in a
+// process group of its own, forwards every signal it receives to that process
+// group, reaps orphaned processes, and exits with the exit code of the workload.
+// When joining the pid namespace of another task the init is not PID 1, and
+// instead becomes a subreaper for the processes of its own task.
+package reaper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Command is the argument that makes the plugin executable run as the init
+// process of a task.
+const Command = "init"
+
+// Arguments returns the arguments for running the init with the given workload
+// command, excluding the executable.
+func Arguments(args []string) []string {
+	return append([]string{Command, "--"}, args...)
+}
+
+// Run the init with the given arguments, excluding the executable and Command,
+// returning the exit code of the workload.
+func Run(args []string) int {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "pledge init: command must be set")
+		return 1
+	}
+
+	// adopt orphans of the workload even when not running as PID 1
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge init: failed to become subreaper: %v\n", err)
+		return 1
+	}
+
+	// subscribe to every signal before starting the workload, so that
+	// neither a signal nor the exit of the workload is missed
+	signals := make(chan os.Signal, 64)
+	signal.Notify(signals)
+
+	code, err := supervise(args, signals)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge init: %v\n", err)
+	}
+	return code
+}
+
+func supervise(args []string, signals <-chan os.Signal) (int, error) {
+	cmd, err := start(args)
+	if errors.Is(err, syscall.ENOEXEC) {
+		// like execvp, run files the kernel cannot execute with the shell,
+		// as is needed by actually portable executables such as pledge
+		cmd, err = start(append([]string{"/bin/sh"}, args...))
+	}
+	if err != nil {
+		return 127, fmt.Errorf("failed to start command: %w", err)
+	}
+	pid := cmd.Process.Pid
+
+	for sig := range signals {
+		switch sig {
+		case unix.SIGCHLD:
+			if code, exited := reap(pid); exited {
+				return code, nil
+			}
+		case unix.SIGURG:
+			// used by the go runtime for preemption
+		default:
+			_ = unix.Kill(-pid, sig.(syscall.Signal))
+		}
+	}
+	return 255, errors.New("signal channel closed")
+}
+
+// start the command of args in a process group of its own.
+func start(args []string) (*exec.Cmd, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true, // signals are forwarded to the process group
+	}
+	return cmd, cmd.Start()
+}
+
+// reap every exited child, returning the exit code of the workload with pid
+// if it is among them.
+func reap(pid int) (int, bool) {
+	for {
+		var status unix.WaitStatus
+		wpid, err := unix.Wait4(-1, &status, unix.WNOHANG, nil)
+		switch {
+		case errors.Is(err, unix.EINTR):
+			continue
+		case err != nil || wpid <= 0:
+			return 0, false
+		case wpid == pid:
+			return code(status), true
+		}
+	}
+}
+
+// code returns the exit code of a process with status, using the shell
+// convention of 128+n for a process terminated by signal n.
+func code(status unix.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
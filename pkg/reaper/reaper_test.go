@@ -0,0 +1,62 @@
+package reaper
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shoenig/test/must"
+	"golang.org/x/sys/unix"
+)
+
+func notify(t *testing.T) chan os.Signal {
+	signals := make(chan os.Signal, 8)
+	signal.Notify(signals, unix.SIGCHLD)
+	t.Cleanup(func() { signal.Stop(signals) })
+	return signals
+}
+
+func TestReaper_Arguments(t *testing.T) {
+	must.Eq(t, []string{"init", "--", "echo", "hi"}, Arguments([]string{"echo", "hi"}))
+}
+
+func TestReaper_exit(t *testing.T) {
+	code, err := supervise([]string{"sh", "-c", "exit 5"}, notify(t))
+	must.NoError(t, err)
+	must.Eq(t, 5, code)
+}
+
+func TestReaper_forward(t *testing.T) {
+	signals := notify(t)
+	go func() {
+		time.Sleep(250 * time.Millisecond)
+		signals <- unix.SIGUSR1
+	}()
+	code, err := supervise([]string{"sh", "-c", `trap "exit 4" USR1; sleep 5 & wait`}, signals)
+	must.NoError(t, err)
+	must.Eq(t, 4, code)
+}
+
+func TestReaper_signaled(t *testing.T) {
+	code, err := supervise([]string{"sh", "-c", "kill -9 $$"}, notify(t))
+	must.NoError(t, err)
+	must.Eq(t, 137, code)
+}
+
+func TestReaper_missing(t *testing.T) {
+	code, err := supervise([]string{"/does/not/exist"}, notify(t))
+	must.Error(t, err)
+	must.Eq(t, 127, code)
+}
+
+func TestReaper_shell(t *testing.T) {
+	// a file the kernel cannot execute is run by the shell
+	script := filepath.Join(t.TempDir(), "script")
+	must.NoError(t, os.WriteFile(script, []byte("exit 6\n"), 0o755))
+
+	code, err := supervise([]string{script}, notify(t))
+	must.NoError(t, err)
+	must.Eq(t, 6, code)
+}
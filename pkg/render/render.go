@@ -0,0 +1,204 @@
+// Package render prints how the plugin would sandbox a task, without a Nomad
+// agent and without starting the task, for debugging and security review.
+//
+// The task configuration is the body of the config block of a task, in HCL or
+// JSON, and is checked against the plugin configuration exactly as the plugin
+// would check it when starting the task. The rendering is the command line of
+// the sandbox, the environment of the sandbox after sanitisation, the writes to
+// the task cgroup, and the effective unveil rules.
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/shoenig/nomad-pledge/pkg/pledge"
+	"github.com/shoenig/nomad-pledge/pkg/plugin"
+)
+
+// Command is the argument that makes the plugin executable render the sandbox
+// of a task.
+const Command = "render"
+
+// allocID is the id of the allocation of the rendered task
+const allocID = "00000000-0000-0000-0000-000000000000"
+
+// defaultPluginConfig is the plugin configuration used when none is given,
+// which needs no pledge executable
+const defaultPluginConfig = `backend = "native"`
+
+// config of a rendering, from the command line
+type config struct {
+	pluginConfig string // file of the plugin configuration (optional, default is the native backend)
+	taskConfig   string // file of the task configuration
+	name         string
+	user         string
+	allocDir     string
+	cgroup       string
+	memory       int64 // MiB
+	memoryMax    int64 // MiB
+	cpu          int64 // MHz
+	env          map[string]string
+	json         bool
+}
+
+// parse the arguments of a rendering, excluding the executable and Command.
+func parse(args []string) (*config, error) {
+	c := &config{env: make(map[string]string)}
+	flags := flag.NewFlagSet(Command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&c.pluginConfig, "config", "", "file of the plugin configuration")
+	flags.StringVar(&c.name, "task", "task", "name of the task")
+	flags.StringVar(&c.user, "user", "", "user of the task")
+	flags.StringVar(&c.allocDir, "alloc-dir", filepath.Join("/opt/nomad/data/alloc", allocID), "allocation directory")
+	flags.StringVar(&c.cgroup, "cgroup", "", "task cgroup")
+	flags.Int64Var(&c.memory, "memory", 300, "memory in MiB")
+	flags.Int64Var(&c.memoryMax, "memory-max", 0, "memory_max in MiB")
+	flags.Int64Var(&c.cpu, "cpu", 100, "cpu in MHz")
+	flags.Func("env", "task environment variable, as KEY=VALUE", func(s string) error {
+		k, v, ok := strings.Cut(s, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("env must be KEY=VALUE, got %q", s)
+		}
+		c.env[k] = v
+		return nil
+	})
+	flags.BoolVar(&c.json, "json", false, "print the rendering as json")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() != 1 {
+		return nil, errors.New("task configuration file must be set")
+	}
+	c.taskConfig = flags.Arg(0)
+	if c.cgroup == "" {
+		c.cgroup = fmt.Sprintf("/sys/fs/cgroup/nomad.slice/share.slice/%s.%s.scope", allocID, c.name)
+	}
+	return c, nil
+}
+
+// Run the rendering given by args, excluding the executable and Command.
+func Run(args []string) int {
+	c, err := parse(args)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge render: %v\n", err)
+		_, _ = fmt.Fprintf(os.Stderr, "usage: %s [-config plugin.hcl] [-env KEY=VALUE ..] [-json] task.hcl\n", Command)
+		return 1
+	}
+	r, err := render(c)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge render: %v\n", err)
+		return 1
+	}
+	if c.json {
+		err = write(os.Stdout, r)
+	} else {
+		text(os.Stdout, r)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge render: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func render(c *config) (*pledge.Rendering, error) {
+	filename, src := "plugin.hcl", []byte(defaultPluginConfig)
+	if c.pluginConfig != "" {
+		var err error
+		if src, err = os.ReadFile(c.pluginConfig); err != nil {
+			return nil, fmt.Errorf("failed to read plugin configuration: %w", err)
+		}
+		filename = c.pluginConfig
+	}
+	pluginConfig, err := plugin.ParseConfig(filename, src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse plugin configuration: %w", err)
+	}
+
+	driver := plugin.New(hclog.NewNullLogger())
+	if err = driver.SetConfig(pluginConfig); err != nil {
+		return nil, fmt.Errorf("invalid plugin configuration: %w", err)
+	}
+
+	src, err = os.ReadFile(c.taskConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task configuration: %w", err)
+	}
+	task := c.task()
+	if err = plugin.ParseTaskConfig(c.taskConfig, src, task); err != nil {
+		return nil, fmt.Errorf("failed to parse task configuration: %w", err)
+	}
+
+	events := func(message string, annotations map[string]string) {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge render: %s %v\n", message, annotations)
+	}
+	return driver.(*plugin.PledgeDriver).Render(task, events)
+}
+
+// task returns the Nomad configuration of the rendered task.
+func (c *config) task() *drivers.TaskConfig {
+	return &drivers.TaskConfig{
+		ID:       allocID + "/" + c.name,
+		AllocID:  allocID,
+		Name:     c.name,
+		User:     c.user,
+		AllocDir: c.allocDir,
+		Env:      c.env,
+		Resources: &drivers.Resources{
+			NomadResources: &structs.AllocatedTaskResources{
+				Cpu:    structs.AllocatedCpuResources{CpuShares: c.cpu},
+				Memory: structs.AllocatedMemoryResources{MemoryMB: c.memory, MemoryMaxMB: c.memoryMax},
+			},
+			LinuxResources: &drivers.LinuxResources{CpusetCgroupPath: c.cgroup},
+		},
+	}
+}
+
+// write the rendering to w as json.
+func write(w io.Writer, r *pledge.Rendering) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// text writes the rendering to w as text.
+func text(w io.Writer, r *pledge.Rendering) {
+	_, _ = fmt.Fprintln(w, "command:")
+	for _, arg := range r.Args {
+		_, _ = fmt.Fprintf(w, "  %s\n", pledge.Quote(arg))
+	}
+	_, _ = fmt.Fprintln(w, "environment:")
+	for _, kv := range r.Env {
+		_, _ = fmt.Fprintf(w, "  %s\n", kv)
+	}
+	_, _ = fmt.Fprintln(w, "cgroup:")
+	for _, cw := range r.Cgroup {
+		required := ""
+		if cw.Required {
+			required = " (required)"
+		}
+		_, _ = fmt.Fprintf(w, "  %s = %s%s\n", cw.File, strconv.Quote(cw.Content), required)
+	}
+	_, _ = fmt.Fprintln(w, "unveil:")
+	if len(r.Unveil) == 0 {
+		_, _ = fmt.Fprintln(w, "  (unrestricted)")
+	}
+	for _, rule := range r.Unveil {
+		_, _ = fmt.Fprintf(w, "  %s\n", rule)
+	}
+	if r.Root != "" {
+		_, _ = fmt.Fprintf(w, "  (emulated with a mount namespace at %s)\n", r.Root)
+	}
+}
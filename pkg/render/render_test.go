@@ -0,0 +1,118 @@
+package render
+
+import (
+	"bytes"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/shoenig/nomad-pledge/pkg/pledge"
+	"github.com/shoenig/test/must"
+)
+
+func TestRender_parse(t *testing.T) {
+	c, err := parse([]string{"-task", "web", "-env", "A=1", "-env", "B=", "-json", "task.hcl"})
+	must.NoError(t, err)
+	must.Eq(t, "task.hcl", c.taskConfig)
+	must.Eq(t, map[string]string{"A": "1", "B": ""}, c.env)
+	must.True(t, c.json)
+	must.StrContains(t, c.cgroup, ".web.scope")
+
+	_, err = parse([]string{"-json"})
+	must.ErrorContains(t, err, "task configuration file must be set")
+
+	_, err = parse([]string{"-env", "A", "task.hcl"})
+	must.ErrorContains(t, err, "KEY=VALUE")
+}
+
+func TestRender_render(t *testing.T) {
+	dir := t.TempDir()
+	pluginConfig := filepath.Join(dir, "plugin.hcl")
+	taskConfig := filepath.Join(dir, "task.json")
+	must.NoError(t, os.WriteFile(pluginConfig, []byte(`backend = "native"`), 0o644))
+	must.NoError(t, os.WriteFile(taskConfig, []byte(`{"command": "echo", "args": ["hello world"], "promises": "stdio"}`), 0o644))
+
+	c, err := parse([]string{"-config", pluginConfig, "-env", "GREETING=hi", taskConfig})
+	must.NoError(t, err)
+	r, err := render(c)
+	must.NoError(t, err)
+	must.Eq(t, []string{"-p", "stdio", "-tmp", filepath.Join(c.allocDir, "task", "tmp", "pledge"), "--", "echo", "hello world"}, r.Args[len(r.Args)-7:])
+	must.SliceContains(t, r.Env, "GREETING=hi")
+	must.Nil(t, r.Unveil)
+
+	var out bytes.Buffer
+	text(&out, r)
+	must.StrContains(t, out.String(), `  "hello world"`)
+	must.StrContains(t, out.String(), "  (unrestricted)")
+}
+
+func TestRender_text(t *testing.T) {
+	var out bytes.Buffer
+	text(&out, &pledge.Rendering{
+		Args:   []string{"unshare", "--", "cat"},
+		Env:    []string{"TMPDIR=/tmp"},
+		Cgroup: []pledge.CgroupWrite{{File: "memory.oom.group", Content: "1", Required: true}},
+		Unveil: []string{"r:/etc"},
+		Root:   "/alloc/task/private/root",
+	})
+	must.Eq(t, `command:
+  unshare
+  --
+  cat
+environment:
+  TMPDIR=/tmp
+cgroup:
+  memory.oom.group = "1" (required)
+unveil:
+  r:/etc
+  (emulated with a mount namespace at /alloc/task/private/root)
+`, out.String())
+}
+
+func TestRender_render_default(t *testing.T) {
+	taskConfig := filepath.Join(t.TempDir(), "task.hcl")
+	must.NoError(t, os.WriteFile(taskConfig, []byte(`
+command  = "echo"
+promises = "stdio"
+`), 0o644))
+
+	// without a plugin configuration, the native backend is used
+	c, err := parse([]string{taskConfig})
+	must.NoError(t, err)
+	r, err := render(c)
+	must.NoError(t, err)
+	must.SliceContains(t, r.Args, "sandbox")
+}
+
+func TestRender_render_dynamicUser(t *testing.T) {
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+
+	// the id of the nobody user is skipped, as it would be when starting
+	dir := t.TempDir()
+	pluginConfig := filepath.Join(dir, "plugin.hcl")
+	taskConfig := filepath.Join(dir, "task.hcl")
+	must.NoError(t, os.WriteFile(pluginConfig, []byte(`
+backend = "native"
+dynamic_user {
+  start = `+nobody.Uid+`
+  count = 2
+}
+`), 0o644))
+	must.NoError(t, os.WriteFile(taskConfig, []byte(`
+command      = "echo"
+dynamic_user = true
+`), 0o644))
+
+	c, err := parse([]string{"-config", pluginConfig, taskConfig})
+	must.NoError(t, err)
+	r, err := render(c)
+	must.NoError(t, err)
+	i := slices.Index(r.Args, "--reuid")
+	must.Positive(t, i)
+	must.NotEq(t, nobody.Uid, r.Args[i+1])
+}
@@ -0,0 +1,20 @@
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CgroupRoot is the mount point of the unified cgroups v2 hierarchy.
+const CgroupRoot = "/sys/fs/cgroup"
+
+// Controllers returns the cgroup v2 controllers available at the root of
+// the unified hierarchy.
+func Controllers() ([]string, error) {
+	b, err := os.ReadFile(filepath.Join(CgroupRoot, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
@@ -5,41 +5,115 @@ import (
 	"strings"
 )
 
-// Importance maps easy to use labels to Linux kernel nice-ness values.
+// Scheduling policies a task may run with.
+const (
+	PolicyOther = "other" // SCHED_OTHER, the default time sharing policy
+	PolicyBatch = "batch" // SCHED_BATCH, for non-interactive cpu-bound work
+	PolicyIdle  = "idle"  // SCHED_IDLE, runs only when the cpu is otherwise idle
+)
+
+// Importance maps easy to use labels to Linux kernel nice-ness values, cgroup
+// io weights, and scheduling policies. The defaults for each label are
 //
-// highest -> -20
-// high    -> -10
-// normal  -> -5
-// low     ->  10
-// lowest  ->  19
+// highest -> nice -20, io.weight 500
+// high    -> nice -10, io.weight 200
+// normal  -> nice   0, io.weight 100
+// low     -> nice  10, io.weight  50
+// lowest  -> nice  19, io.weight  10
+//
+// Normal matches the kernel defaults, so ordinary tasks do not outrank the
+// Nomad agent. No label changes the scheduling policy by default, because the
+// batch and idle policies need chrt, which not every node has.
 type Importance struct {
-	Label string
-	Nice  int
+	Label    string
+	Nice     int    // cpu.weight.nice of the task cgroup
+	IOWeight int    // io.weight of the task cgroup, or 0 to leave unchanged
+	Policy   string // scheduling policy, or empty to leave unchanged
 }
 
 func (s *Importance) String() string {
-	return fmt.Sprintf("(%s %d)", s.Label, s.Nice)
+	return fmt.Sprintf("(%s %d %d %s)", s.Label, s.Nice, s.IOWeight, s.Policy)
 }
 
-func ParseImportance(s string) (*Importance, error) {
-	label := strings.ToLower(s)
-	nice := 0
-	switch label {
-	case "highest":
-		nice = -20
-	case "high":
-		nice = -10
-	case "", "normal":
-		nice = -5
-	case "low":
-		nice = 10
-	case "lowest":
-		nice = 19
+// Override replaces the settings of the importance with those that are set,
+// leaving the importance unchanged if the result is invalid.
+func (s *Importance) Override(nice, ioWeight *int, policy string) error {
+	result := *s
+	if nice != nil {
+		result.Nice = *nice
+	}
+	if ioWeight != nil {
+		result.IOWeight = *ioWeight
+	}
+	if policy != "" {
+		result.Policy = strings.ToLower(policy)
+	}
+	if err := result.Validate(); err != nil {
+		return err
+	}
+	*s = result
+	return nil
+}
+
+// Validate the settings of the importance.
+func (s *Importance) Validate() error {
+	switch {
+	case s.Nice < -20 || s.Nice > 19:
+		return fmt.Errorf("nice of %d not in range [-20, 19]", s.Nice)
+	case s.IOWeight != 0 && (s.IOWeight < 1 || s.IOWeight > 10000):
+		return fmt.Errorf("io weight of %d not in range [1, 10000]", s.IOWeight)
+	}
+	switch s.Policy {
+	case "", PolicyOther, PolicyBatch, PolicyIdle:
+		return nil
 	default:
+		return fmt.Errorf("scheduling policy of %q not recognized", s.Policy)
+	}
+}
+
+// Levels maps each importance label to its settings.
+type Levels map[string]Importance
+
+// DefaultLevels returns the default settings of each importance label.
+func DefaultLevels() Levels {
+	return Levels{
+		"highest": {Label: "highest", Nice: -20, IOWeight: 500},
+		"high":    {Label: "high", Nice: -10, IOWeight: 200},
+		"normal":  {Label: "normal", Nice: 0, IOWeight: 100},
+		"low":     {Label: "low", Nice: 10, IOWeight: 50},
+		"lowest":  {Label: "lowest", Nice: 19, IOWeight: 10},
+	}
+}
+
+// Set overrides the settings of the importance label with those that are set.
+func (l Levels) Set(label string, nice, ioWeight *int, policy string) error {
+	label = strings.ToLower(label)
+	level, exists := l[label]
+	if !exists {
+		return fmt.Errorf("importance of %q not recognized", label)
+	}
+	if err := level.Override(nice, ioWeight, policy); err != nil {
+		return fmt.Errorf("importance %q: %w", label, err)
+	}
+	l[label] = level
+	return nil
+}
+
+// Parse returns the settings of the importance label, where the empty label
+// means normal.
+func (l Levels) Parse(s string) (*Importance, error) {
+	label := strings.ToLower(s)
+	if label == "" {
+		label = "normal"
+	}
+	level, exists := l[label]
+	if !exists {
 		return nil, fmt.Errorf("importance of %q not recognized", label)
 	}
-	return &Importance{
-		Label: label,
-		Nice:  nice,
-	}, nil
+	return &level, nil
+}
+
+// ParseImportance returns the default settings of the importance label.
+func ParseImportance(s string) (*Importance, error) {
+	return DefaultLevels().Parse(s)
 }
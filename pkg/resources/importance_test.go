@@ -0,0 +1,53 @@
+package resources
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/shoenig/test/must"
+)
+
+func TestParseImportance(t *testing.T) {
+	i, err := ParseImportance("")
+	must.NoError(t, err)
+	must.Eq(t, &Importance{Label: "normal", Nice: 0, IOWeight: 100}, i)
+
+	i, err = ParseImportance("Lowest")
+	must.NoError(t, err)
+	must.Eq(t, &Importance{Label: "lowest", Nice: 19, IOWeight: 10}, i)
+
+	_, err = ParseImportance("urgent")
+	must.ErrorContains(t, err, `importance of "urgent" not recognized`)
+}
+
+func TestImportance_Override(t *testing.T) {
+	i, err := ParseImportance("low")
+	must.NoError(t, err)
+	must.NoError(t, i.Override(pointer.Of(5), nil, "batch"))
+	must.Eq(t, &Importance{Label: "low", Nice: 5, IOWeight: 50, Policy: PolicyBatch}, i)
+
+	must.NoError(t, i.Override(nil, pointer.Of(1000), "IDLE"))
+	must.Eq(t, &Importance{Label: "low", Nice: 5, IOWeight: 1000, Policy: PolicyIdle}, i)
+
+	must.ErrorContains(t, i.Override(pointer.Of(20), nil, ""), "nice of 20 not in range")
+	must.ErrorContains(t, i.Override(nil, pointer.Of(10001), ""), "io weight of 10001 not in range")
+	must.ErrorContains(t, i.Override(nil, nil, "fifo"), `scheduling policy of "fifo" not recognized`)
+}
+
+func TestLevels_Set(t *testing.T) {
+	levels := DefaultLevels()
+	must.NoError(t, levels.Set("normal", pointer.Of(-5), nil, ""))
+	i, err := levels.Parse("")
+	must.NoError(t, err)
+	must.Eq(t, -5, i.Nice)
+	must.Eq(t, 100, i.IOWeight)
+
+	// parsed settings are copies of the level
+	i.Nice = 7
+	i, err = levels.Parse("normal")
+	must.NoError(t, err)
+	must.Eq(t, -5, i.Nice)
+
+	must.ErrorContains(t, levels.Set("urgent", nil, nil, ""), "not recognized")
+	must.ErrorContains(t, levels.Set("high", nil, nil, "rr"), `importance "high"`)
+}
@@ -0,0 +1,139 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// record is the durable encoding of an Exit.
+type record struct {
+	Code      int    `json:"code"`
+	Interrupt int    `json:"interrupt"`
+	Error     string `json:"error,omitempty"`
+}
+
+// WriteExit durably records exit into file, such that the file either does
+// not exist or contains the complete exit status.
+func WriteExit(file string, exit *Exit) error {
+	r := record{Code: exit.Code, Interrupt: exit.Interrupt}
+	if exit.Err != nil {
+		r.Error = exit.Err.Error()
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode exit status: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create exit status file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write exit status file: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync exit status file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close exit status file: %w", err)
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// ReadExit reads the exit status recorded in file by WriteExit.
+func ReadExit(file string) (*Exit, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var r record
+	if err = json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode exit status: %w", err)
+	}
+	exit := &Exit{Code: r.Code, Interrupt: r.Interrupt}
+	if r.Error != "" {
+		exit.Err = errors.New(r.Error)
+	}
+	return exit, nil
+}
+
+// WaitOnSupervisor waits on the supervisor of a task, which is a child of the
+// plugin, then reads the exit status of the task recorded by the supervisor.
+func WaitOnSupervisor(p *os.Process, file string) Waiter {
+	return &supervisorWaiter{
+		wait: func() { _, _ = p.Wait() },
+		file: file,
+	}
+}
+
+// WaitOnOrphanSupervisor waits on the supervisor of a task the plugin must
+// reattach to, then reads the exit status of the task recorded by the
+// supervisor. Unlike WaitOnOrphan, the exit status is never lost, because the
+// supervisor writes it down before exiting. The is function reports whether
+// the process with pid is still the supervisor, rather than an unrelated
+// process that reused its pid.
+func WaitOnOrphanSupervisor(pid int, file string, is func(pid int) bool) Waiter {
+	return &supervisorWaiter{
+		wait: func() { pollExit(pid, file, is) },
+		file: file,
+	}
+}
+
+type supervisorWaiter struct {
+	wait func()
+	file string
+}
+
+func (w *supervisorWaiter) Wait() *Exit {
+	w.wait()
+	exit, err := ReadExit(w.file)
+	if err != nil {
+		return &Exit{
+			Code: 255,
+			Err:  fmt.Errorf("failed to read exit status of task: %w", err),
+		}
+	}
+	return exit
+}
+
+// pollExit blocks until the supervisor with pid exits, unless the exit status
+// has already been recorded. The pid may have been reused if the supervisor
+// exited while the plugin was not running, which is why the exit status file
+// is checked again, and the process is checked to still be the supervisor,
+// after acquiring the pidfd.
+func pollExit(pid int, file string, is func(int) bool) {
+	if exists(file) {
+		return
+	}
+
+	fd, err := openFD(pid)
+	if err != nil {
+		return // supervisor is already gone
+	}
+	defer func() { _ = unix.Close(int(fd)) }()
+
+	if exists(file) || !is(pid) {
+		return
+	}
+
+	pollFD := []unix.PollFd{{Fd: fd, Events: unix.POLLIN}}
+	for {
+		if _, err = unix.Poll(pollFD, -1); !errors.Is(err, unix.EINTR) {
+			return
+		}
+	}
+}
+
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
@@ -0,0 +1,80 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestExit_WriteRead(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pledge.exit")
+
+	must.NoError(t, WriteExit(file, &Exit{Code: 137, Interrupt: 9, Err: errors.New("killed")}))
+	exit, err := ReadExit(file)
+	must.NoError(t, err)
+	must.Eq(t, 137, exit.Code)
+	must.Eq(t, 9, exit.Interrupt)
+	must.EqError(t, exit.Err, "killed")
+
+	must.NoError(t, WriteExit(file, &Exit{Code: 0}))
+	exit, err = ReadExit(file)
+	must.NoError(t, err)
+	must.Zero(t, exit.Code)
+	must.NoError(t, exit.Err)
+}
+
+func TestSupervisor_WaitRecorded(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pledge.exit")
+	must.NoError(t, WriteExit(file, &Exit{Code: 3}))
+
+	// the supervisor is long gone, and its pid may have been reused
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sleep", "10")
+	must.NoError(t, cmd.Start())
+
+	exit := WaitOnOrphanSupervisor(cmd.Process.Pid, file, func(int) bool { return true }).Wait()
+	must.NoError(t, exit.Err)
+	must.Eq(t, 3, exit.Code)
+}
+
+func TestSupervisor_WaitMissing(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pledge.exit")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sleep", ".1s")
+	must.NoError(t, cmd.Start())
+
+	exit := WaitOnSupervisor(cmd.Process, file).Wait()
+	must.Error(t, exit.Err)
+	must.Eq(t, 255, exit.Code)
+}
+
+func TestSupervisor_WaitReused(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pledge.exit")
+
+	// the supervisor died without recording the exit status, and its pid
+	// was reused by an unrelated process
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sleep", "10")
+	must.NoError(t, cmd.Start())
+
+	done := make(chan *Exit)
+	go func() {
+		done <- WaitOnOrphanSupervisor(cmd.Process.Pid, file, func(int) bool { return false }).Wait()
+	}()
+	select {
+	case exit := <-done:
+		must.Error(t, exit.Err)
+		must.Eq(t, 255, exit.Code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("waited on an unrelated process")
+	}
+}
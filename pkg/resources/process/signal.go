@@ -1,54 +1,116 @@
 package process
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 type Signaler interface {
 	Signal(s string) error
 }
 
-func parse(s string) syscall.Signal {
-	switch strings.ToLower(s) {
-	case "sighup":
-		return syscall.SIGHUP
-	case "sigint":
-		return syscall.SIGINT
-	case "sigquit":
-		return syscall.SIGQUIT
-	case "sigtrap":
-		return syscall.SIGTRAP
-	case "sigabrt":
-		return syscall.SIGABRT
-	case "sigkill":
-		return syscall.SIGKILL
-	case "sigusr1":
-		return syscall.SIGUSR1
-	case "sigusr2":
-		return syscall.SIGUSR2
-	case "sigalrm":
-		return syscall.SIGALRM
-	case "sigterm":
-		return syscall.SIGTERM
-	case "sigstop":
-		return syscall.SIGSTOP
-	case "sigpwr":
-		return syscall.SIGPWR
-	default:
-		return syscall.SIGSTOP
+const (
+	// sigRTMin is the first realtime signal available to applications, as
+	// defined by glibc (which reserves 32 and 33 for threading).
+	sigRTMin = 34
+
+	// sigRTMax is the last realtime signal.
+	sigRTMax = 64
+)
+
+// aliases are alternative names of signals not known to unix.SignalNum.
+var aliases = map[string]string{
+	"SIGIOT":  "SIGABRT",
+	"SIGPOLL": "SIGIO",
+	"SIGCLD":  "SIGCHLD",
+}
+
+// Parse the signal described by s, which may be the name of a signal with or
+// without the SIG prefix (case-insensitive), the number of a signal, or a
+// realtime signal relative to SIGRTMIN or SIGRTMAX (e.g. SIGRTMIN+3).
+func Parse(s string) (syscall.Signal, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+
+	// signal by number, e.g. 15
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < 1 || n > sigRTMax {
+			return 0, fmt.Errorf("signal number %d out of range", n)
+		}
+		return syscall.Signal(n), nil
+	}
+
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	// realtime signal, e.g. SIGRTMIN+3 or SIGRTMAX-2
+	if strings.HasPrefix(name, "SIGRTMIN") || strings.HasPrefix(name, "SIGRTMAX") {
+		return realtime(name)
+	}
+
+	if alias, exists := aliases[name]; exists {
+		name = alias
+	}
+
+	if sig := unix.SignalNum(name); sig != 0 {
+		return sig, nil
+	}
+
+	return 0, fmt.Errorf("signal %q not recognized", s)
+}
+
+// realtime parses the name of a realtime signal, e.g. SIGRTMIN+3
+func realtime(name string) (syscall.Signal, error) {
+	base, offset := sigRTMin, name[len("SIGRTMIN"):]
+	if strings.HasPrefix(name, "SIGRTMAX") {
+		base = sigRTMax
+	}
+
+	n := 0
+	if offset != "" {
+		var err error
+		if n, err = strconv.Atoi(offset); err != nil || (offset[0] != '+' && offset[0] != '-') {
+			return 0, fmt.Errorf("signal %q not recognized", name)
+		}
 	}
+
+	sig := base + n
+	if sig < sigRTMin || sig > sigRTMax {
+		return 0, fmt.Errorf("signal %q out of range", name)
+	}
+	return syscall.Signal(sig), nil
+}
+
+// Uncatchable returns whether signal can be neither caught nor ignored, and
+// therefore cannot be forwarded by the process receiving it.
+func Uncatchable(signal string) bool {
+	s, err := Parse(signal)
+	return err == nil && (s == unix.SIGKILL || s == unix.SIGSTOP)
 }
 
+// Interrupts creates a Signaler that signals the process group of pid.
 func Interrupts(pid int) Signaler {
-	return &sysSignal{pid: pid}
+	return &sysSignal{target: -pid}
+}
+
+// InterruptsProcess creates a Signaler that signals only the process with pid,
+// rather than its process group.
+func InterruptsProcess(pid int) Signaler {
+	return &sysSignal{target: pid}
 }
 
 type sysSignal struct {
-	pid int
+	target int // negative for a process group
 }
 
 func (sig *sysSignal) Signal(signal string) error {
-	s := parse(signal)
-	return syscall.Kill(-sig.pid, s)
+	s, err := Parse(signal)
+	if err != nil {
+		return err
+	}
+	return syscall.Kill(sig.target, s)
 }
@@ -0,0 +1,69 @@
+package process
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/shoenig/test/must"
+)
+
+func TestSignal_Parse(t *testing.T) {
+	cases := []struct {
+		name string
+		exp  syscall.Signal
+	}{
+		{"sigterm", syscall.SIGTERM},
+		{"SIGTERM", syscall.SIGTERM},
+		{"term", syscall.SIGTERM},
+		{"SIGWINCH", syscall.SIGWINCH},
+		{"cont", syscall.SIGCONT},
+		{"SIGIOT", syscall.SIGABRT},
+		{"9", syscall.SIGKILL},
+		{"SIGRTMIN", 34},
+		{"SIGRTMIN+3", 37},
+		{"rtmax-1", 63},
+		{"SIGRTMAX", 64},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sig, err := Parse(tc.name)
+			must.NoError(t, err)
+			must.Eq(t, tc.exp, sig)
+		})
+	}
+}
+
+func TestSignal_Parse_invalid(t *testing.T) {
+	cases := []string{
+		"",
+		"SIGTREM",
+		"0",
+		"65",
+		"SIGRTMIN-1",
+		"SIGRTMAX+1",
+		"SIGRTMIN3",
+		"SIGRTMINX",
+	}
+
+	for _, name := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(name)
+			must.Error(t, err)
+		})
+	}
+}
+
+func TestSignal_Signal_invalid(t *testing.T) {
+	s := Interrupts(1)
+	must.ErrorContains(t, s.Signal("SIGBOGUS"), "not recognized")
+}
+
+func TestSignal_Uncatchable(t *testing.T) {
+	must.True(t, Uncatchable("SIGSTOP"))
+	must.True(t, Uncatchable("kill"))
+	must.True(t, Uncatchable("9"))
+	must.False(t, Uncatchable("SIGTERM"))
+	must.False(t, Uncatchable("SIGCONT"))
+	must.False(t, Uncatchable("SIGBOGUS"))
+}
@@ -0,0 +1,83 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Children returns the pids of the children of every thread of pid.
+//
+// See `man proc`.
+// /proc/[pid]/task/[tid]/children (since Linux 3.5)
+func Children(pid int) []int {
+	threads, err := filepath.Glob(filepath.Join("/proc", strconv.Itoa(pid), "task", "*", "children"))
+	if err != nil {
+		return nil
+	}
+	var result []int
+	for _, file := range threads {
+		b, rErr := os.ReadFile(file)
+		if rErr != nil {
+			continue
+		}
+		for _, field := range strings.Fields(string(b)) {
+			if child, aErr := strconv.Atoi(field); aErr == nil {
+				result = append(result, child)
+			}
+		}
+	}
+	return result
+}
+
+// Find returns the first descendant of pid, in breadth first order, for which
+// match returns true.
+func Find(pid int, match func(int) bool) (int, bool) {
+	queue := Children(pid)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if match(next) {
+			return next, true
+		}
+		queue = append(queue, Children(next)...)
+	}
+	return 0, false
+}
+
+// Cmdline returns the command line arguments of pid.
+func Cmdline(pid int) []string {
+	b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return nil
+	}
+	b = bytes.TrimSuffix(b, []byte{0})
+	if len(b) == 0 {
+		return nil
+	}
+	return strings.Split(string(b), "\x00")
+}
+
+// Group returns the process group id of pid.
+//
+// See `man proc`.
+// (5) pgrp  %d
+func Group(pid int) (int, error) {
+	f := filepath.Join("/proc", strconv.Itoa(pid), "stat")
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return 0, err
+	}
+	// the command name may contain spaces, and is followed by the state
+	var fields []string
+	if i := bytes.LastIndexByte(b, ')'); i >= 0 {
+		fields = strings.Fields(string(b[i+1:]))
+	}
+	if len(fields) < 3 {
+		return 0, fmt.Errorf("failed to read process group from %q", f)
+	}
+	return strconv.Atoi(fields[2])
+}
@@ -0,0 +1,57 @@
+package process
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/shoenig/test/must"
+	"github.com/shoenig/test/wait"
+)
+
+func TestTree_Find(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", "sleep 5 & wait")
+	must.NoError(t, cmd.Start())
+
+	var pid int
+	must.Wait(t, wait.InitialSuccess(
+		wait.BoolFunc(func() bool {
+			var exists bool
+			pid, exists = Find(cmd.Process.Pid, func(p int) bool {
+				args := Cmdline(p)
+				return len(args) > 0 && args[0] == "sleep"
+			})
+			return exists
+		}),
+		wait.Timeout(time.Second),
+		wait.Gap(10*time.Millisecond),
+	))
+	must.Eq(t, []string{"sleep", "5"}, Cmdline(pid))
+	must.SliceContains(t, Children(cmd.Process.Pid), pid)
+
+	_, exists := Find(cmd.Process.Pid, func(int) bool { return false })
+	must.False(t, exists)
+}
+
+func TestTree_Group(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sleep", "5")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	must.NoError(t, cmd.Start())
+
+	group, err := Group(cmd.Process.Pid)
+	must.NoError(t, err)
+	must.Eq(t, cmd.Process.Pid, group)
+
+	group, err = Group(os.Getpid())
+	must.NoError(t, err)
+	must.Eq(t, syscall.Getpgrp(), group)
+}
@@ -1,6 +1,7 @@
 package process
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -65,11 +66,16 @@ func (w *pidWaiter) Wait() *Exit {
 		}
 	}
 
-	pollFD := []unix.PollFd{{Fd: fd}}
+	pollFD := []unix.PollFd{{Fd: fd, Events: unix.POLLIN}}
 	timeout := -1 // infinite
 
-	// we should check the return is what we expect
-	_, _ = unix.Poll(pollFD, timeout)
+	// poll is interrupted by any signal delivered to the plugin, including
+	// those the go runtime uses for preemption
+	for {
+		if _, err = unix.Poll(pollFD, timeout); !errors.Is(err, unix.EINTR) {
+			break
+		}
+	}
 
 	// lookup exit code from /proc/<pid>/stat ?
 	code, err := codeFromStat(w.pid)
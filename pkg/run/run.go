@@ -0,0 +1,294 @@
+// Package run runs a command in the sandbox of a task without a Nomad agent,
+// for iterating on the promises and unveil rules of a task locally.
+//
+// The command is started with pledge.New like any task, in a temporary cgroup
+// removed once the command exits, after which the exit code, the number of
+// violations, and the resource usage of the command are printed.
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shoenig/nomad-pledge/pkg/pledge"
+	"github.com/shoenig/nomad-pledge/pkg/resources"
+	"github.com/shoenig/nomad-pledge/pkg/sandbox"
+	"github.com/shoenig/nomad-pledge/pkg/util"
+)
+
+// Command is the argument that makes the plugin executable run a command in
+// a sandbox, as it would run a task.
+const Command = "run"
+
+// list is a flag that may be given more than once
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// config of a run, from the command line
+type config struct {
+	promises     string
+	execPromises string
+	unveil       list
+	importance   string
+	user         string
+	group        string
+	pledge       string // pledge executable, or empty for the native sandbox
+	cgroup       string // parent of the temporary cgroup
+	memory       uint64 // MiB
+	cpu          uint64 // MHz
+	command      []string
+}
+
+// parse the arguments of a run, excluding the executable and Command.
+func parse(args []string) (*config, error) {
+	c := new(config)
+	flags := flag.NewFlagSet(Command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&c.promises, "promises", "", "promises of the command")
+	flags.StringVar(&c.execPromises, "exec-promises", "", "promises of programs executed by the command")
+	flags.Var(&c.unveil, "unveil", "unveil rule, may be repeated")
+	flags.StringVar(&c.importance, "importance", "", "importance of the command")
+	flags.StringVar(&c.user, "user", "", "user to run the command as")
+	flags.StringVar(&c.group, "group", "", "primary group to run the command as")
+	flags.StringVar(&c.pledge, "pledge", "", "pledge executable, instead of the native sandbox")
+	flags.StringVar(&c.cgroup, "cgroup", "/sys/fs/cgroup", "parent of the temporary cgroup")
+	flags.Uint64Var(&c.memory, "memory", 1024, "memory limit in MiB")
+	flags.Uint64Var(&c.cpu, "cpu", 1000, "cpu limit in MHz")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	c.command = flags.Args()
+	switch {
+	case len(c.command) == 0:
+		return nil, errors.New("command must be set")
+	case c.pledge != "" && c.execPromises != "":
+		return nil, errors.New("exec-promises requires the native sandbox")
+	}
+	return c, nil
+}
+
+// Run the command given by args, excluding the executable and Command, and
+// return its exit code.
+func Run(args []string) int {
+	c, err := parse(args)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge run: %v\n", err)
+		_, _ = fmt.Fprintf(os.Stderr, "usage: %s [-promises ..] [-unveil ..] -- command [args]\n", Command)
+		return 1
+	}
+	code, err := run(c)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge run: %v\n", err)
+	}
+	return code
+}
+
+func run(c *config) (int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return 1, fmt.Errorf("failed to find plugin executable: %w", err)
+	}
+
+	if c.user == "" {
+		u, uErr := user.Current()
+		if uErr != nil {
+			return 1, fmt.Errorf("failed to find current user: %w", uErr)
+		}
+		c.user = u.Username
+	}
+
+	importance, err := resources.ParseImportance(c.importance)
+	if err != nil {
+		return 1, err
+	}
+
+	bandwidth, err := resources.Bandwidth(c.cpu)
+	if err != nil {
+		return 1, fmt.Errorf("failed to compute cpu bandwidth: %w", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return 1, fmt.Errorf("failed to find working directory: %w", err)
+	}
+
+	// the private tmp directory of the command
+	tmp, err := os.MkdirTemp("", "pledge-run-")
+	if err != nil {
+		return 1, fmt.Errorf("failed to create tmp directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	cgroup := filepath.Join(c.cgroup, fmt.Sprintf("pledge-run-%d", os.Getpid()))
+	if err = os.Mkdir(cgroup, 0o755); err != nil {
+		return 1, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	defer remove(cgroup)
+
+	stderr := &violations{w: os.Stderr}
+	env := &pledge.Environment{
+		User:      c.user,
+		Out:       util.NullCloser(os.Stdout),
+		Err:       util.NullCloser(stderr),
+		Env:       environ(),
+		Dir:       wd,
+		Tmp:       tmp,
+		Cgroup:    cgroup,
+		Memory:    c.memory * 1024 * 1024,
+		Bandwidth: bandwidth,
+		Events: func(message string, _ map[string]string) {
+			_, _ = fmt.Fprintf(os.Stderr, "pledge run: %s\n", message)
+		},
+		Init: self,
+	}
+	if c.pledge == "" {
+		env.Sandbox = self
+	}
+
+	opts := &pledge.Options{
+		Command:      c.command[0],
+		Arguments:    c.command[1:],
+		Promises:     c.promises,
+		ExecPromises: c.execPromises,
+		Report:       c.pledge == "",
+		Unveil:       c.unveil,
+		Importance:   importance,
+		Group:        c.group,
+	}
+
+	// forward interrupts to the command, which decides whether to exit
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := pledge.New(c.pledge, env, opts)
+	if err = e.Start(ctx); err != nil {
+		return 1, err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			_ = e.Signal(sig.String())
+		}
+	}()
+
+	err = e.Wait()
+	code := e.Result()
+
+	u := usage(cgroup)
+	_, _ = fmt.Fprintf(os.Stderr, "pledge run: exit code %d\n", code)
+	if c.pledge == "" {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge run: %d violations\n", stderr.count())
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "pledge run: cpu %s user, %s system\n", u.user, u.system)
+	if u.peak > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge run: memory %d KiB peak\n", u.peak/1024)
+	}
+	return code, err
+}
+
+// environ returns the environment of the run as a map.
+func environ() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	return env
+}
+
+// remove the cgroup, once every process in it has exited.
+func remove(cgroup string) {
+	for i := 0; i < 50; i++ {
+		if err := os.Remove(cgroup); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "pledge run: failed to remove cgroup %s\n", cgroup)
+}
+
+// resource usage of a cgroup over its lifetime
+type resourceUsage struct {
+	user   time.Duration
+	system time.Duration
+	peak   uint64 // bytes, 0 if unknown
+}
+
+// usage reads the resource usage of the cgroup.
+func usage(cgroup string) resourceUsage {
+	var u resourceUsage
+	if b, err := os.ReadFile(filepath.Join(cgroup, "cpu.stat")); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			usec, _ := strconv.ParseInt(value, 10, 64)
+			switch key {
+			case "user_usec":
+				u.user = time.Duration(usec) * time.Microsecond
+			case "system_usec":
+				u.system = time.Duration(usec) * time.Microsecond
+			}
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(cgroup, "memory.peak")); err == nil {
+		u.peak, _ = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	}
+	return u
+}
+
+// violations passes output through to w, counting the violations reported
+// by the native sandbox.
+type violations struct {
+	w io.Writer
+
+	lock    sync.Mutex
+	partial []byte
+	n       int
+}
+
+func (v *violations) Write(p []byte) (int, error) {
+	v.lock.Lock()
+	v.partial = append(v.partial, p...)
+	for {
+		i := bytes.IndexByte(v.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if bytes.HasPrefix(v.partial[:i], []byte(sandbox.Violation)) {
+			v.n++
+		}
+		v.partial = v.partial[i+1:]
+	}
+	v.lock.Unlock()
+	return v.w.Write(p)
+}
+
+func (v *violations) count() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.n
+}
@@ -0,0 +1,65 @@
+package run
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shoenig/nomad-pledge/pkg/sandbox"
+	"github.com/shoenig/test/must"
+)
+
+func TestRun_parse(t *testing.T) {
+	c, err := parse([]string{
+		"-promises", "stdio rpath",
+		"-unveil", "r:/etc",
+		"-unveil", "rwc:/tmp",
+		"-memory", "64",
+		"--", "cat", "/etc/hostname",
+	})
+	must.NoError(t, err)
+	must.Eq(t, "stdio rpath", c.promises)
+	must.Eq(t, []string{"r:/etc", "rwc:/tmp"}, []string(c.unveil))
+	must.Eq(t, 64, c.memory)
+	must.Eq(t, 1000, c.cpu)
+	must.Eq(t, "/sys/fs/cgroup", c.cgroup)
+	must.Eq(t, []string{"cat", "/etc/hostname"}, c.command)
+
+	_, err = parse([]string{"-promises", "stdio"})
+	must.ErrorContains(t, err, "command must be set")
+
+	_, err = parse([]string{"-pledge", "/opt/bin/pledge.com", "-exec-promises", "stdio", "true"})
+	must.ErrorContains(t, err, "requires the native sandbox")
+
+	_, err = parse([]string{"-bogus", "true"})
+	must.Error(t, err)
+}
+
+func TestRun_violations(t *testing.T) {
+	var out bytes.Buffer
+	v := &violations{w: &out}
+
+	_, _ = v.Write([]byte("hello\n" + sandbox.Violation + "socket (pid 1)\n" + sandbox.Violation))
+	must.Eq(t, 1, v.count())
+
+	// lines may span writes
+	_, _ = v.Write([]byte("clone (pid 2)\nworld\n"))
+	must.Eq(t, 2, v.count())
+	must.StrContains(t, out.String(), "world")
+}
+
+func TestRun_usage(t *testing.T) {
+	dir := t.TempDir()
+	must.NoError(t, os.WriteFile(filepath.Join(dir, "cpu.stat"),
+		[]byte("usage_usec 3000\nuser_usec 2000\nsystem_usec 1000\n"), 0o644))
+	must.NoError(t, os.WriteFile(filepath.Join(dir, "memory.peak"), []byte("4096\n"), 0o644))
+
+	u := usage(dir)
+	must.Eq(t, 2*time.Millisecond, u.user)
+	must.Eq(t, time.Millisecond, u.system)
+	must.Eq(t, 4096, u.peak)
+
+	must.Eq(t, resourceUsage{}, usage(filepath.Join(dir, "missing")))
+}
@@ -0,0 +1,332 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/shoenig/nomad-pledge/pkg/seccomp"
+	"golang.org/x/sys/unix"
+)
+
+// ioctl requests missing from x/sys/unix, the same on every architecture
+// supported by the filter
+const (
+	ioctlFIONREAD = 0x541b
+	ioctlFIONBIO  = 0x5421
+	ioctlFIONCLEX = 0x5450
+	ioctlFIOCLEX  = 0x5451
+)
+
+// cloneNamespaces are the clone flags creating new namespaces, which processes
+// and threads are never created in; the exit signal shares the low byte of the
+// flags with CLONE_NEWTIME, which is only accepted by clone3
+const cloneNamespaces = unix.CLONE_NEWNS | unix.CLONE_NEWCGROUP | unix.CLONE_NEWUTS |
+	unix.CLONE_NEWIPC | unix.CLONE_NEWUSER | unix.CLONE_NEWPID | unix.CLONE_NEWNET
+
+// conditions shared by promise groups
+var (
+	openReadOnly = seccomp.Cond{Arg: 1, Mask: unix.O_ACCMODE | unix.O_CREAT, Value: unix.O_RDONLY}
+	openWrite    = seccomp.Cond{Arg: 1, Mask: unix.O_ACCMODE | unix.O_CREAT, Value: unix.O_WRONLY}
+	openReadW    = seccomp.Cond{Arg: 1, Mask: unix.O_ACCMODE | unix.O_CREAT, Value: unix.O_RDWR}
+	openCreate   = seccomp.Cond{Arg: 1, Mask: unix.O_ACCMODE | unix.O_CREAT, Value: unix.O_RDONLY | unix.O_CREAT}
+	createWrite  = seccomp.Cond{Arg: 1, Mask: unix.O_ACCMODE | unix.O_CREAT, Value: unix.O_WRONLY | unix.O_CREAT}
+	createReadW  = seccomp.Cond{Arg: 1, Mask: unix.O_ACCMODE | unix.O_CREAT, Value: unix.O_RDWR | unix.O_CREAT}
+
+	emptyPath  = seccomp.Cond{Arg: 3, Mask: unix.AT_EMPTY_PATH, Value: unix.AT_EMPTY_PATH}
+	statxEmpty = seccomp.Cond{Arg: 2, Mask: unix.AT_EMPTY_PATH, Value: unix.AT_EMPTY_PATH}
+	getLimit   = seccomp.Cond{Arg: 2, Mask: ^uint64(0), Value: 0}
+	noAddress  = seccomp.Cond{Arg: 4, Mask: ^uint64(0), Value: 0}
+	noExec     = seccomp.Cond{Arg: 2, Mask: unix.PROT_EXEC, Value: 0}
+
+	noNamespaces = seccomp.Cond{Arg: 0, Mask: cloneNamespaces, Value: 0}
+)
+
+// openat takes its flags one argument later than open
+func at(c seccomp.Cond) seccomp.Cond {
+	c.Arg++
+	return c
+}
+
+func equals(arg int, values ...uint64) []seccomp.Cond {
+	conds := make([]seccomp.Cond, 0, len(values))
+	for _, v := range values {
+		conds = append(conds, seccomp.Cond{Arg: arg, Mask: 0xffffffff, Value: v})
+	}
+	return conds
+}
+
+// rule allows a system call, under any one of conds if given
+type rule struct {
+	name  string
+	conds []seccomp.Cond
+}
+
+func allow(names ...string) []rule {
+	rules := make([]rule, 0, len(names))
+	for _, name := range names {
+		rules = append(rules, rule{name: name})
+	}
+	return rules
+}
+
+func when(name string, conds ...seccomp.Cond) rule {
+	return rule{name: name, conds: conds}
+}
+
+func join(groups ...[]rule) []rule {
+	var result []rule
+	for _, g := range groups {
+		result = append(result, g...)
+	}
+	return result
+}
+
+// baseline system calls are always allowed, because they are needed to exec
+// the command and to set up any process; like the pledge utility, the command
+// is always allowed to exec. The go runtime of the sandbox may also need to
+// wake other threads before exec.
+var baseline = join(
+	allow(
+		"execve", "execveat", "exit", "exit_group", "restart_syscall", "rt_sigreturn",
+		"brk", "munmap", "arch_prctl", "set_tid_address", "set_robust_list", "rseq",
+		"futex",
+	),
+	[]rule{
+		when("mmap", noExec),
+		when("mprotect", noExec),
+	},
+)
+
+// loader system calls are allowed for dynamically linked commands, because
+// the dynamic loader must read and map shared libraries before the command
+// itself runs
+var loader = join(
+	allow(
+		"read", "pread64", "close", "fstat", "newfstatat", "statx", "access",
+		"faccessat", "faccessat2", "getrandom", "mmap", "mprotect",
+	),
+	[]rule{
+		when("open", openReadOnly),
+		when("openat", at(openReadOnly)),
+		when("prlimit64", getLimit),
+	},
+)
+
+var (
+	pathStat = allow(
+		"getcwd", "stat", "fstat", "lstat", "newfstatat", "statx", "access",
+		"faccessat", "faccessat2", "readlink", "readlinkat",
+	)
+	sockets = allow(
+		"listen", "bind", "connect", "accept", "accept4", "getpeername",
+		"getsockname", "setsockopt", "getsockopt", "sendto", "recvfrom",
+	)
+	inet = equals(0, unix.AF_INET, unix.AF_INET6)
+)
+
+// groups maps each promise to the system calls it allows; see
+// https://justine.lol/pledge/
+var groups = map[string][]rule{
+	"stdio": join(
+		allow(
+			"close", "close_range", "dup", "dup2", "dup3", "fchdir", "fstat", "fsync",
+			"fdatasync", "ftruncate", "getdents", "getdents64", "getegid", "getrandom",
+			"geteuid", "getgid", "getgroups", "getitimer", "getpgid", "getpgrp",
+			"getpid", "gettid", "getppid", "getresgid", "getresuid", "getrlimit",
+			"getsid", "wait4", "waitid", "gettimeofday", "getuid", "lseek", "madvise",
+			"uname", "clock_getres", "clock_gettime", "clock_nanosleep", "nanosleep",
+			"msync", "mremap", "pipe", "pipe2", "read", "readv", "pread64", "preadv",
+			"preadv2", "recvfrom", "recvmsg", "sendmsg", "poll", "ppoll", "select",
+			"pselect6", "epoll_create", "epoll_create1", "epoll_ctl", "epoll_wait",
+			"epoll_pwait", "epoll_pwait2", "eventfd", "eventfd2", "timerfd_create",
+			"timerfd_settime", "timerfd_gettime", "write", "writev", "pwrite64",
+			"pwritev", "pwritev2", "setitimer", "alarm", "pause", "shutdown",
+			"rt_sigaction", "sigaltstack", "rt_sigprocmask", "rt_sigsuspend",
+			"rt_sigtimedwait", "umask", "socketpair", "sched_yield",
+			"sched_getaffinity", "getcpu", "tgkill", "tkill",
+		),
+		[]rule{
+			when("newfstatat", emptyPath),
+			when("statx", statxEmpty),
+			when("prlimit64", getLimit),
+			when("sendto", noAddress),
+			when("ioctl", equals(1, ioctlFIONREAD, ioctlFIONBIO, ioctlFIOCLEX, ioctlFIONCLEX)...),
+			when("fcntl", equals(1, unix.F_GETFD, unix.F_SETFD, unix.F_GETFL, unix.F_SETFL, unix.F_DUPFD, unix.F_DUPFD_CLOEXEC)...),
+		},
+	),
+	"rpath": join(
+		pathStat,
+		allow("chdir", "statfs", "fstatfs"),
+		[]rule{
+			when("open", openReadOnly),
+			when("openat", at(openReadOnly)),
+		},
+	),
+	"wpath": join(
+		pathStat,
+		allow("chmod", "fchmod", "fchmodat", "truncate"),
+		[]rule{
+			when("open", openWrite, openReadW),
+			when("openat", at(openWrite), at(openReadW)),
+		},
+	),
+	"cpath": join(
+		allow(
+			"rename", "renameat", "renameat2", "link", "linkat", "symlink",
+			"symlinkat", "unlink", "unlinkat", "rmdir", "mkdir", "mkdirat",
+		),
+		[]rule{
+			when("open", openCreate),
+			when("openat", at(openCreate)),
+		},
+	),
+	"dpath": allow("mknod", "mknodat"),
+	"chown": allow("chown", "fchown", "lchown", "fchownat"),
+	"flock": join(
+		allow("flock"),
+		[]rule{
+			when("fcntl", equals(1, unix.F_GETLK, unix.F_SETLK, unix.F_SETLKW, unix.F_OFD_GETLK, unix.F_OFD_SETLK, unix.F_OFD_SETLKW)...),
+		},
+	),
+	"tty": {
+		when("ioctl", equals(1, unix.TIOCGWINSZ, unix.TCGETS, unix.TCSETS, unix.TCSETSW, unix.TCSETSF)...),
+	},
+	"recvfd": allow("recvmsg"),
+	"sendfd": allow("sendmsg"),
+	"fattr": allow(
+		"chmod", "fchmod", "fchmodat", "utime", "utimes", "futimesat", "utimensat",
+	),
+	"inet": join(
+		sockets,
+		[]rule{when("socket", inet...)},
+	),
+	"unix": join(
+		sockets,
+		[]rule{when("socket", equals(0, unix.AF_UNIX)...)},
+	),
+	"dns": join(
+		allow("sendto", "recvfrom", "connect"),
+		[]rule{when("socket", inet...)},
+	),
+	"proc": join(
+		allow(
+			"fork", "vfork", "kill", "getpriority", "setpriority", "prlimit64",
+			"setrlimit", "setpgid", "setsid", "sched_getscheduler",
+			"sched_setscheduler", "sched_get_priority_min", "sched_get_priority_max",
+			"sched_getparam", "sched_setparam", "sched_setaffinity",
+		),
+		[]rule{when("clone", noNamespaces)},
+	),
+	"thread": join(
+		allow("futex", "get_robust_list", "sched_yield", "mprotect"),
+		[]rule{when("clone", noNamespaces)},
+	),
+	"id": allow(
+		"setuid", "setreuid", "setresuid", "setgid", "setregid", "setresgid",
+		"setgroups", "prlimit64", "setrlimit", "getpriority", "setpriority",
+		"setfsuid", "setfsgid",
+	),
+	"exec":      allow("execve", "execveat"),
+	"prot_exec": allow("mmap", "mprotect"),
+	"tmppath":   allow("unlink", "unlinkat", "lstat", "newfstatat"),
+	"vminfo":    allow("sysinfo"),
+}
+
+// combined maps promises to the system calls they allow only together; opening
+// a file for writing while creating it needs both wpath and cpath
+var combined = []struct {
+	promises []string
+	rules    []rule
+}{
+	{
+		promises: []string{"wpath", "cpath"},
+		rules: []rule{
+			when("open", createWrite, createReadW),
+			when("openat", at(createWrite), at(createReadW)),
+			when("creat"),
+		},
+	},
+}
+
+// Policy returns the seccomp policy allowing the system calls of promises,
+// including those needed by the dynamic loader if dynamic is set.
+func Policy(promises []string, dynamic bool) (seccomp.Policy, error) {
+	policy := make(seccomp.Policy)
+	add := func(rules []rule) {
+		for _, r := range rules {
+			policy.Allow(r.name, r.conds...)
+		}
+	}
+
+	add(baseline)
+	if dynamic {
+		add(loader)
+	}
+	for _, promise := range promises {
+		rules, exists := groups[promise]
+		if !exists {
+			return nil, fmt.Errorf("promise %q not recognized", promise)
+		}
+		add(rules)
+	}
+	for _, c := range combined {
+		if contains(promises, c.promises) {
+			add(c.rules)
+		}
+	}
+	return policy, nil
+}
+
+// loaderPromises are needed by the dynamic loader
+var loaderPromises = []string{"rpath", "prot_exec"}
+
+// CheckExecPromises returns an error if the exec promises are set but lack the
+// promises needed by the dynamic loader. Whether the programs executed by the
+// command are dynamically linked is not known in advance, so the exec promises
+// must always allow loading them.
+func CheckExecPromises(promises string) error {
+	if promises != "" && !contains(strings.Fields(promises), loaderPromises) {
+		return errors.New("exec promises must include rpath and prot_exec, which are needed by the dynamic loader of executed programs")
+	}
+	return nil
+}
+
+// ExecPolicy returns the seccomp policy allowing the system calls of the exec
+// promises, which apply to programs executed by the command.
+func ExecPolicy(promises []string) (seccomp.Policy, error) {
+	if err := CheckExecPromises(strings.Join(promises, " ")); err != nil {
+		return nil, err
+	}
+	return Policy(promises, false)
+}
+
+// differences returns the system calls policy allows, but execPolicy does not
+// allow in the same way; along with execve and execveat, these are deferred to
+// the supervisor of the sandbox.
+func differences(policy, execPolicy seccomp.Policy) []string {
+	result := []string{"execve", "execveat"}
+	for name, conds := range policy {
+		if name == "execve" || name == "execveat" {
+			continue
+		}
+		other, exists := execPolicy[name]
+		if !exists || !slices.Equal(conds, other) {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// contains returns whether promises includes every one of wanted.
+func contains(promises, wanted []string) bool {
+	for _, w := range wanted {
+		if !slices.Contains(promises, w) {
+			return false
+		}
+	}
+	return true
+}
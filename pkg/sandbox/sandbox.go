@@ -0,0 +1,329 @@
+// Package sandbox implements pledge and unveil natively, as an alternative to
+// the external pledge utility.
+//
+// The sandbox is the plugin executable re-invoked with the Command argument,
+// and runs as the last stage before the command of a task. It restricts the
+// filesystem access of its thread to the unveiled paths with Landlock, and the
+// system calls of its thread to those allowed by the promises with a seccomp
+// filter, and then executes the command, which inherits both.
+package sandbox
+
+import (
+	"bufio"
+	"debug/elf"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/shoenig/nomad-pledge/pkg/landlock"
+	"github.com/shoenig/nomad-pledge/pkg/seccomp"
+	"golang.org/x/sys/unix"
+)
+
+// Command is the argument that makes the plugin executable apply the promises
+// and unveil rules of a task before executing the command.
+const Command = "sandbox"
+
+// defaultPromises apply when no promises are given, like the pledge utility
+const defaultPromises = "stdio rpath"
+
+// Violation prefixes the line reported for each system call denied to the
+// command, when reporting violations.
+const Violation = "pledge violation: "
+
+// Arguments returns the arguments for running the sandbox with promises, the
+// promises of programs executed by the command, whether to report violations,
+// the private tmp directory of the task, and unveil rules, followed by the
+// given command, excluding the executable.
+func Arguments(promises, execPromises string, report bool, tmp string, unveil []string, args []string) []string {
+	var result = []string{Command}
+	if promises != "" {
+		result = append(result, "-p", promises)
+	}
+	if execPromises != "" {
+		result = append(result, "-e", execPromises)
+	}
+	if report {
+		result = append(result, "-report")
+	}
+	if tmp != "" {
+		result = append(result, "-tmp", tmp)
+	}
+	for _, u := range unveil {
+		result = append(result, "-v", u)
+	}
+	result = append(result, "--")
+	return append(result, args...)
+}
+
+// Run the sandbox with the given arguments, excluding the executable and
+// Command. On success Run does not return, because the process is replaced by
+// the command.
+func Run(args []string) int {
+	var unveil []string
+	flags := flag.NewFlagSet(Command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	promises := flags.String("p", defaultPromises, "promises")
+	execPromises := flags.String("e", "", "promises of executed programs")
+	notify := flags.Bool("notify", false, "defer system calls to the parent")
+	report := flags.Bool("report", false, "report denied system calls")
+	tmp := flags.String("tmp", "", "private tmp directory unveiled by tmppath")
+	flags.Func("v", "unveil rule", func(s string) error {
+		unveil = append(unveil, s)
+		return nil
+	})
+
+	err := flags.Parse(args)
+	if err == nil && flags.NArg() == 0 {
+		err = errors.New("command must be set")
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge sandbox: %v\n", err)
+		return 1
+	}
+
+	command := flags.Args()
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge sandbox: %v\n", err)
+		return 127
+	}
+
+	// programs executed by the command are held to the exec promises, and
+	// violations are reported, by a parent supervising the sandbox
+	if (*execPromises != "" || *report) && !*notify {
+		code, sErr := supervise(path, args, strings.Fields(*promises), strings.Fields(*execPromises), *report)
+		if sErr != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "pledge sandbox: %v\n", sErr)
+		}
+		return code
+	}
+
+	// landlock rules and seccomp filters apply to the calling thread, which
+	// must be the one that executes the command
+	runtime.LockOSThread()
+
+	err = restrict(path, strings.Fields(*promises), strings.Fields(*execPromises), *tmp, unveil, *report)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge sandbox: %v\n", err)
+		return 1
+	}
+
+	// the command may not be allowed to write, so there is no error message
+	_ = syscall.Exec(path, command, os.Environ())
+	return 127
+}
+
+// restrict the calling thread to the promises and unveil rules, allowing
+// whatever is needed to execute the command at path. If exec promises are
+// given, the system calls that would be denied by them are deferred to the
+// supervisor of the sandbox, as are the system calls denied by the promises
+// when reporting violations.
+func restrict(path string, promises, execPromises []string, tmp string, unveil []string, report bool) error {
+	executables, dynamic := inspect(path)
+
+	policy, err := Policy(promises, dynamic)
+	if err != nil {
+		return err
+	}
+
+	var deferred []string
+	if len(execPromises) > 0 {
+		execPolicy, eErr := ExecPolicy(execPromises)
+		if eErr != nil {
+			return eErr
+		}
+		deferred = differences(policy, execPolicy)
+	}
+
+	if len(unveil) > 0 {
+		paths, pErr := unveiled(unveil, executables, promises, tmp, dynamic)
+		if pErr != nil {
+			return pErr
+		}
+		if err = landlock.RestrictPaths(paths); err != nil {
+			return err
+		}
+	}
+
+	// installing a seccomp filter without CAP_SYS_ADMIN requires no_new_privs
+	if err = unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+
+	// when reporting, a single filter both enforces the policy and defers
+	// system calls to the supervisor, including the exec of the command, so
+	// the supervisor takes the listener before it is closed on exec
+	if report {
+		if len(deferred) == 0 {
+			deferred = []string{"execve", "execveat"}
+		}
+		_, err = policy.InstallReporting(deferred)
+		return err
+	}
+
+	// the listener must be installed first, because the policy denies the
+	// seccomp system call; the listener is close-on-exec, and is taken by the
+	// supervisor before the deferred exec of the command may proceed
+	if len(deferred) > 0 {
+		if _, err = seccomp.InstallNotify(deferred); err != nil {
+			return err
+		}
+	}
+	return policy.Install()
+}
+
+// Executables returns the paths needed to execute the program at path: the
+// program itself, the interpreter of a script, and the libraries of the
+// dynamic loader if any of them is dynamically linked. Paths that do not
+// exist are skipped.
+func Executables(path string) []string {
+	executables, dynamic := inspect(path)
+	if dynamic {
+		executables = append(executables, libraries...)
+	}
+	result := make([]string, 0, len(executables))
+	for _, p := range executables {
+		if _, err := os.Stat(p); err == nil {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Widens returns whether the command at path is allowed system calls beyond
+// its promises for as long as it runs, because it is dynamically linked and the
+// promises lack the rpath or prot_exec promises needed by the dynamic loader.
+func Widens(path, promises string) bool {
+	if promises == "" {
+		promises = defaultPromises
+	}
+	_, dynamic := inspect(path)
+	return dynamic && !contains(strings.Fields(promises), loaderPromises)
+}
+
+// inspect the executable at path, returning the executables needed to run it
+// and whether any of them needs the dynamic loader. A script needs its
+// interpreter, which is assumed to be dynamically linked if it cannot be
+// inspected itself.
+func inspect(path string) ([]string, bool) {
+	if interp, ok := interpreter(path); ok {
+		return []string{path, interp}, true
+	}
+	if script := shebang(path); script != "" {
+		executables, dynamic := inspect(script)
+		return append([]string{path}, executables...), dynamic
+	}
+	return []string{path}, false
+}
+
+// interpreter returns the program interpreter (dynamic loader) of the ELF
+// executable at path, if it is dynamically linked.
+func interpreter(path string) (string, bool) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer func() { _ = f.Close() }()
+
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		b, rErr := io.ReadAll(prog.Open())
+		if rErr != nil {
+			return "", true
+		}
+		return strings.TrimRight(string(b), "\x00"), true
+	}
+	return "", false
+}
+
+// shebang returns the interpreter of the script at path, or the empty string
+// if path is not a script.
+func shebang(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// libraries are read by the dynamic loader
+var libraries = []string{
+	"/etc/ld.so.cache",
+	"/lib",
+	"/lib64",
+	"/usr/lib",
+	"/usr/lib64",
+	"/usr/local/lib",
+}
+
+// vminfo paths are unveiled by the vminfo promise
+var vminfo = []string{
+	"/proc/stat",
+	"/proc/meminfo",
+	"/proc/cpuinfo",
+	"/proc/diskstats",
+	"/proc/self/maps",
+	"/sys/devices/system/cpu",
+}
+
+// unveiled returns the paths of the unveil rules, along with the paths
+// unveiled automatically like the pledge utility does: the executables needed
+// to run the command, the libraries of the dynamic loader, the private tmp
+// directory of the task (rather than the /tmp shared by every task) for the
+// tmppath promise, and system information for the vminfo promise. Automatic
+// paths that do not exist are skipped.
+func unveiled(unveil, executables, promises []string, tmp string, dynamic bool) ([]landlock.Path, error) {
+	var paths []landlock.Path
+	for _, u := range unveil {
+		p, err := landlock.ParseUnveil(u)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+
+	auto := func(perms string, list ...string) {
+		for _, path := range list {
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			p, _ := landlock.ParseUnveil(perms + ":" + path)
+			paths = append(paths, p)
+		}
+	}
+
+	auto("rx", executables...)
+	if dynamic {
+		auto("rx", libraries...)
+	}
+	for _, promise := range promises {
+		switch promise {
+		case "tmppath":
+			if tmp != "" {
+				auto("rwc", tmp)
+			}
+		case "vminfo":
+			auto("r", vminfo...)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,262 @@
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/shoenig/nomad-pledge/pkg/seccomp"
+	"github.com/shoenig/test/must"
+	"golang.org/x/sys/unix"
+)
+
+// the test binary runs the sandbox when re-executed by sandbox
+func TestMain(m *testing.M) {
+	if os.Getenv("SANDBOX_TEST_RUN") == "1" {
+		os.Exit(Run(os.Args[2:]))
+	}
+	os.Exit(m.Run())
+}
+
+func sandbox(t *testing.T, promises string, unveil []string, args ...string) (string, int) {
+	return sandboxExec(t, promises, "", unveil, args...)
+}
+
+func sandboxExec(t *testing.T, promises, execPromises string, unveil []string, args ...string) (string, int) {
+	return sandboxArgs(t, Arguments(promises, execPromises, false, "", unveil, args))
+}
+
+func sandboxArgs(t *testing.T, args []string) (string, int) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "SANDBOX_TEST_RUN=1")
+	b, _ := cmd.CombinedOutput()
+	return strings.TrimSpace(string(b)), cmd.ProcessState.ExitCode()
+}
+
+func TestSandbox_Arguments(t *testing.T) {
+	args := Arguments("stdio rpath", "", false, "", []string{"r:/etc"}, []string{"cat", "/etc/hostname"})
+	must.Eq(t, []string{"sandbox", "-p", "stdio rpath", "-v", "r:/etc", "--", "cat", "/etc/hostname"}, args)
+
+	args = Arguments("stdio tmppath", "", false, "/alloc/task/tmp/pledge", nil, []string{"true"})
+	must.Eq(t, []string{"sandbox", "-p", "stdio tmppath", "-tmp", "/alloc/task/tmp/pledge", "--", "true"}, args)
+
+	args = Arguments("", "", false, "", nil, []string{"true"})
+	must.Eq(t, []string{"sandbox", "--", "true"}, args)
+
+	args = Arguments("stdio proc exec", "stdio", true, "", nil, []string{"true"})
+	must.Eq(t, []string{"sandbox", "-p", "stdio proc exec", "-e", "stdio", "-report", "--", "true"}, args)
+}
+
+func TestSandbox_Policy(t *testing.T) {
+	policy, err := Policy([]string{"stdio", "inet"}, false)
+	must.NoError(t, err)
+	must.MapContainsKeys(t, policy, []string{"execve", "read", "socket"})
+	must.MapNotContainsKey(t, policy, "openat")
+	must.SliceLen(t, 1, policy["mmap"]) // without PROT_EXEC
+
+	policy, err = Policy([]string{"stdio", "prot_exec"}, false)
+	must.NoError(t, err)
+	must.Nil(t, policy["mmap"])
+
+	_, err = Policy([]string{"stdio", "bogus"}, false)
+	must.EqError(t, err, `promise "bogus" not recognized`)
+}
+
+func TestSandbox_Policy_clone(t *testing.T) {
+	policy, err := Policy([]string{"stdio", "proc", "thread"}, false)
+	must.NoError(t, err)
+	must.MapNotContainsKey(t, policy, "clone3")
+
+	fork := [6]uint64{uint64(unix.SIGCHLD)}
+	thread := [6]uint64{unix.CLONE_VM | unix.CLONE_FS | unix.CLONE_FILES | unix.CLONE_SIGHAND | unix.CLONE_THREAD}
+	must.True(t, policy.Allows("clone", fork))
+	must.True(t, policy.Allows("clone", thread))
+	must.False(t, policy.Allows("clone", [6]uint64{unix.CLONE_NEWUSER | uint64(unix.SIGCHLD)}))
+	must.False(t, policy.Allows("clone", [6]uint64{unix.CLONE_NEWNS}))
+}
+
+func TestSandbox_Policy_create(t *testing.T) {
+	open := func(flags int) [6]uint64 { return [6]uint64{0, uint64(flags), 0o644} }
+
+	// cpath alone only creates files opened read-only
+	policy, err := Policy([]string{"stdio", "cpath"}, false)
+	must.NoError(t, err)
+	must.True(t, policy.Allows("open", open(unix.O_RDONLY|unix.O_CREAT)))
+	must.False(t, policy.Allows("open", open(unix.O_RDWR|unix.O_CREAT)))
+	must.False(t, policy.Allows("open", open(unix.O_WRONLY|unix.O_CREAT|unix.O_TRUNC)))
+	must.MapNotContainsKey(t, policy, "creat")
+
+	// and wpath alone does not create files
+	policy, err = Policy([]string{"stdio", "wpath"}, false)
+	must.NoError(t, err)
+	must.True(t, policy.Allows("open", open(unix.O_RDWR)))
+	must.False(t, policy.Allows("open", open(unix.O_RDWR|unix.O_CREAT)))
+
+	// together they create files opened for writing
+	policy, err = Policy([]string{"stdio", "wpath", "cpath"}, false)
+	must.NoError(t, err)
+	must.True(t, policy.Allows("open", open(unix.O_RDWR|unix.O_CREAT)))
+	must.True(t, policy.Allows("openat", [6]uint64{0, 0, uint64(unix.O_WRONLY | unix.O_CREAT)}))
+	must.MapContainsKey(t, policy, "creat")
+}
+
+func TestSandbox_unveiled(t *testing.T) {
+	tmp := t.TempDir()
+	paths, err := unveiled([]string{"r:/etc"}, []string{"/bin/sh"}, []string{"tmppath"}, tmp, false)
+	must.NoError(t, err)
+	must.SliceLen(t, 3, paths)
+	must.Eq(t, "/etc", paths[0].Path)
+	must.Eq(t, "/bin/sh", paths[1].Path)
+	must.Eq(t, tmp, paths[2].Path)
+
+	// the shared /tmp is never unveiled automatically
+	paths, err = unveiled(nil, nil, []string{"tmppath"}, "", false)
+	must.NoError(t, err)
+	must.SliceEmpty(t, paths)
+
+	_, err = unveiled([]string{"q:/etc"}, nil, nil, "", false)
+	must.Error(t, err)
+}
+
+func TestSandbox_inspect(t *testing.T) {
+	script := t.TempDir() + "/script.sh"
+	must.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho hi\n"), 0o755))
+
+	executables, _ := inspect(script)
+	must.Eq(t, []string{script, "/bin/sh"}, executables[:2])
+
+	executables, dynamic := inspect(os.Args[0])
+	must.Eq(t, []string{os.Args[0]}, executables[:1])
+	_, isDynamic := interpreter(os.Args[0])
+	must.Eq(t, isDynamic, dynamic)
+}
+
+func TestSandbox_Widens(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	must.NoError(t, err)
+	if _, dynamic := inspect(sh); !dynamic {
+		t.Skip("sh is not dynamically linked")
+	}
+
+	must.True(t, Widens(sh, ""))
+	must.True(t, Widens(sh, "stdio rpath"))
+	must.False(t, Widens(sh, "stdio rpath prot_exec"))
+
+	script := t.TempDir() + "/script"
+	must.NoError(t, os.WriteFile(script, []byte("echo hi\n"), 0o755))
+	must.False(t, Widens(script, "stdio"))
+}
+
+func TestSandbox_Run(t *testing.T) {
+	if !seccomp.Supported() {
+		t.Skip("seccomp filters not supported")
+	}
+
+	output, code := sandbox(t, "stdio rpath", nil, "sh", "-c", "echo hello")
+	must.Eq(t, 0, code)
+	must.Eq(t, "hello", output)
+
+	// forking is not allowed without the proc promise
+	_, code = sandbox(t, "stdio rpath", nil, "sh", "-c", "/bin/true; echo")
+	must.Positive(t, code)
+
+	// writing is not allowed without the wpath and cpath promises
+	file := t.TempDir() + "/file"
+	_, code = sandbox(t, "stdio rpath", nil, "sh", "-c", "echo x > "+file)
+	must.Positive(t, code)
+	_, err := os.Stat(file)
+	must.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSandbox_Run_unveil(t *testing.T) {
+	if !seccomp.Supported() {
+		t.Skip("seccomp filters not supported")
+	}
+
+	dir := t.TempDir()
+	must.NoError(t, os.WriteFile(dir+"/file", []byte("secret\n"), 0o644))
+
+	output, code := sandbox(t, "stdio rpath", []string{"r:/etc"}, "sh", "-c", "read x < "+dir+"/file && echo $x")
+	must.Positive(t, code)
+	must.StrNotContains(t, output, "secret")
+
+	output, code = sandbox(t, "stdio rpath", []string{"r:" + dir}, "sh", "-c", "read x < "+dir+"/file && echo $x")
+	must.Eq(t, "secret", output)
+	must.Eq(t, 0, code)
+}
+
+func TestSandbox_differences(t *testing.T) {
+	policy, err := Policy([]string{"stdio", "proc", "exec"}, false)
+	must.NoError(t, err)
+	execPolicy, err := ExecPolicy([]string{"stdio", "rpath", "prot_exec"})
+	must.NoError(t, err)
+
+	deferred := differences(policy, execPolicy)
+	must.SliceContainsSubset(t, deferred, []string{"execve", "execveat", "fork", "kill", "mmap", "mprotect"})
+	must.SliceNotContains(t, deferred, "read")
+	must.SliceNotContains(t, deferred, "futex")
+}
+
+func TestSandbox_ExecPolicy(t *testing.T) {
+	// executed programs must be able to load
+	_, err := ExecPolicy([]string{"stdio", "rpath"})
+	must.ErrorContains(t, err, "must include rpath and prot_exec")
+
+	// and are not allowed anything else the loader of the command is
+	policy, err := ExecPolicy([]string{"rpath", "prot_exec"})
+	must.NoError(t, err)
+	must.MapNotContainsKey(t, policy, "read")
+
+	must.NoError(t, CheckExecPromises(""))
+	must.Error(t, CheckExecPromises("stdio"))
+}
+
+func TestSandbox_lookup(t *testing.T) {
+	id, ppid, err := lookup(os.Getpid())
+	must.NoError(t, err)
+	must.Eq(t, os.Getpid(), id.pid)
+	must.Positive(t, id.start)
+	must.Eq(t, os.Getppid(), ppid)
+
+	_, _, err = lookup(-1)
+	must.Error(t, err)
+}
+
+func TestSandbox_Run_execPromises(t *testing.T) {
+	if !seccomp.Supported() {
+		t.Skip("seccomp filters not supported")
+	}
+
+	// the command may fork, but the programs it executes may not
+	output, code := sandboxExec(t, "stdio rpath proc exec", "stdio rpath prot_exec", nil,
+		"sh", "-c", `(echo forked); sh -c "(echo nested)"; echo done`)
+	must.Eq(t, 0, code)
+	must.StrContains(t, output, "forked")
+	must.StrNotContains(t, output, "nested")
+	must.StrContains(t, output, "done")
+
+	// exit codes pass through the supervisor
+	_, code = sandboxExec(t, "stdio rpath proc exec", "stdio rpath prot_exec", nil, "sh", "-c", "exit 7")
+	must.Eq(t, 7, code)
+}
+
+func TestSandbox_Run_report(t *testing.T) {
+	if !seccomp.Supported() {
+		t.Skip("seccomp filters not supported")
+	}
+
+	// denied system calls are reported, and still fail
+	output, _ := sandboxArgs(t, Arguments("stdio rpath exec", "", true, "", nil,
+		[]string{"sh", "-c", "(echo forked)"}))
+	must.StrNotContains(t, output, "forked")
+	must.StrContains(t, output, Violation+"clone")
+
+	// along with those denied by the exec promises
+	output, code := sandboxArgs(t, Arguments("stdio rpath proc exec", "stdio rpath prot_exec", true, "", nil,
+		[]string{"sh", "-c", `sh -c "(echo nested)"; echo done`}))
+	must.Eq(t, 0, code)
+	must.StrNotContains(t, output, "nested")
+	must.StrContains(t, output, "by exec_promises")
+	must.StrContains(t, output, "done")
+}
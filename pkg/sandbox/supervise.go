@@ -0,0 +1,269 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shoenig/nomad-pledge/pkg/seccomp"
+	"golang.org/x/sys/unix"
+)
+
+// listenerTimeout is how long to wait for the sandbox to install its listener
+const listenerTimeout = 5 * time.Second
+
+// supervise runs the sandbox with args beneath a supervisor, which holds every
+// program executed by the command at path to the exec promises, if any. The
+// sandbox defers execve, and the system calls allowed by the promises but not
+// by the exec promises, to the supervisor. Processes that have executed a
+// program since the command started, and their children, are denied those
+// system calls. When reporting, the sandbox also defers the system calls
+// denied by the promises, which the supervisor reports as violations.
+//
+// The supervisor returns the exit code of the command.
+func supervise(path string, args, promises, execPromises []string, report bool) (int, error) {
+	_, dynamic := inspect(path)
+	policy, err := Policy(promises, dynamic)
+	if err != nil {
+		return 1, err
+	}
+
+	var execPolicy seccomp.Policy
+	if len(execPromises) > 0 {
+		if execPolicy, err = ExecPolicy(execPromises); err != nil {
+			return 1, err
+		}
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return 1, fmt.Errorf("failed to find sandbox executable: %w", err)
+	}
+
+	// the command receives the signals sent to its process group itself, and
+	// the supervisor must outlive it; handled signals are reset by exec
+	signals := make(chan os.Signal, 64)
+	signal.Notify(signals)
+	go func() {
+		for range signals {
+		}
+	}()
+
+	// keep the command from inspecting or taking over the supervisor
+	if err = unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0); err != nil {
+		return 1, fmt.Errorf("failed to make supervisor undumpable: %w", err)
+	}
+
+	cmd := exec.Command(self, append([]string{Command, "-notify"}, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err = cmd.Start(); err != nil {
+		return 127, fmt.Errorf("failed to start sandbox: %w", err)
+	}
+
+	listener, err := listen(cmd.Process.Pid, listenerTimeout)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return 1, err
+	}
+	defer func() { _ = listener.Close() }()
+
+	t := newTracker(cmd.Process.Pid, policy, execPolicy)
+	t.report = report
+	go func() {
+		for {
+			n, rErr := listener.Receive()
+			if rErr != nil {
+				return
+			}
+			t.handle(listener, n)
+		}
+	}()
+
+	_ = cmd.Wait()
+	status := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return status.ExitStatus(), nil
+}
+
+// listen takes the seccomp listener installed by the sandbox with pid, waiting
+// up to timeout for the listener to be installed.
+func listen(pid int, timeout time.Duration) (*seccomp.Listener, error) {
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sandbox pidfd: %w", err)
+	}
+	defer func() { _ = unix.Close(pidfd) }()
+
+	dir := fmt.Sprintf("/proc/%d/fd", pid)
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		entries, dErr := os.ReadDir(dir)
+		if dErr != nil {
+			return nil, fmt.Errorf("failed to find sandbox listener: %w", dErr)
+		}
+		for _, entry := range entries {
+			link, _ := os.Readlink(filepath.Join(dir, entry.Name()))
+			if link != "anon_inode:seccomp notify" {
+				continue
+			}
+			target, _ := strconv.Atoi(entry.Name())
+			fd, gErr := unix.PidfdGetfd(pidfd, target, 0)
+			if gErr != nil {
+				return nil, fmt.Errorf("failed to take sandbox listener: %w", gErr)
+			}
+			return seccomp.NewListener(fd), nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil, errors.New("timeout waiting for sandbox listener")
+}
+
+// identity of a process, which survives pid reuse
+type identity struct {
+	pid   int
+	start uint64 // start time, in clock ticks since boot
+}
+
+// tracker tracks which processes of the sandbox have executed a program since
+// the command started, and are held to the exec policy.
+type tracker struct {
+	root       int  // pid of the sandbox, which becomes the command
+	started    bool // whether the command has been executed
+	report     bool // whether denied system calls are reported
+	policy     seccomp.Policy
+	execPolicy seccomp.Policy // nil without exec promises
+	executed   map[identity]bool
+}
+
+func newTracker(root int, policy, execPolicy seccomp.Policy) *tracker {
+	return &tracker{
+		root:       root,
+		policy:     policy,
+		execPolicy: execPolicy,
+		executed:   make(map[identity]bool),
+	}
+}
+
+// handle the deferred system call of notification n.
+func (t *tracker) handle(l *seccomp.Listener, n *seccomp.Notification) {
+	id, ppid, err := lookup(n.PID)
+
+	// the process must still be the caller once it has been looked up
+	if !l.Valid(n.ID) {
+		return
+	}
+	if err != nil {
+		_ = l.Deny(n.ID, unix.EPERM)
+		return
+	}
+
+	switch {
+	case !t.policy.Allows(n.Name, n.Args):
+		// only deferred when reporting violations
+		t.violation(n, "")
+		_ = l.Deny(n.ID, unix.EPERM)
+	case n.Name == "execve" || n.Name == "execveat":
+		// the sandbox executing the command is the only exec that keeps the
+		// promises; the exec may yet fail, in which case the caller is still
+		// held to the exec policy
+		if id.pid == t.root && !t.started {
+			t.started = true
+			t.executed[id] = false
+		} else {
+			t.executed[id] = true
+		}
+		_ = l.Continue(n.ID)
+	case t.execPolicy == nil || !t.hasExecuted(id, ppid) || t.execPolicy.Allows(n.Name, n.Args):
+		_ = l.Continue(n.ID)
+	default:
+		t.violation(n, "exec_promises")
+		_ = l.Deny(n.ID, unix.EPERM)
+	}
+}
+
+// violation reports the system call of notification n, which is denied by the
+// promises, or by the given exec promises.
+func (t *tracker) violation(n *seccomp.Notification, by string) {
+	if !t.report {
+		return
+	}
+	name := n.Name
+	if name == "" {
+		name = fmt.Sprintf("syscall %d", n.Nr)
+	}
+	if by != "" {
+		name += " by " + by
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "%s%s (pid %d)\n", Violation, name, n.PID)
+}
+
+// hasExecuted returns whether the process with id, or any of its ancestors up
+// to the command, has executed a program since the command started. The status
+// of a process is decided the first time it is looked up; processes whose
+// ancestry is unknown are assumed to have executed a program.
+func (t *tracker) hasExecuted(id identity, ppid int) bool {
+	if executed, exists := t.executed[id]; exists {
+		return executed
+	}
+
+	executed := true
+	if id.pid != t.root && ppid > 1 {
+		if parent, grandparent, err := lookup(ppid); err == nil {
+			executed = t.hasExecuted(parent, grandparent)
+		}
+	}
+	t.executed[id] = executed
+	return executed
+}
+
+// lookup returns the identity and parent pid of the process of the thread with
+// tid.
+func lookup(tid int) (identity, int, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		return identity{}, 0, err
+	}
+
+	var tgid, ppid int
+	for _, line := range strings.Split(string(b), "\n") {
+		key, value, _ := strings.Cut(line, ":")
+		switch key {
+		case "Tgid":
+			tgid, _ = strconv.Atoi(strings.TrimSpace(value))
+		case "PPid":
+			ppid, _ = strconv.Atoi(strings.TrimSpace(value))
+		}
+	}
+	if tgid == 0 {
+		return identity{}, 0, fmt.Errorf("failed to find process of thread %d", tid)
+	}
+
+	// the start time is the 22nd field, the fields after the command name
+	// in parentheses begin with the 3rd
+	b, err = os.ReadFile(fmt.Sprintf("/proc/%d/stat", tgid))
+	if err != nil {
+		return identity{}, 0, err
+	}
+	s := string(b)
+	fields := strings.Fields(s[strings.LastIndex(s, ")")+1:])
+	if len(fields) < 20 {
+		return identity{}, 0, fmt.Errorf("failed to parse stat of process %d", tgid)
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return identity{}, 0, fmt.Errorf("failed to parse start time of process %d: %w", tgid, err)
+	}
+	return identity{pid: tgid, start: start}, ppid, nil
+}
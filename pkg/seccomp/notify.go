@@ -0,0 +1,224 @@
+package seccomp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// from linux/seccomp.h
+const (
+	filterFlagNewListener = 1 << 3
+	retUserNotif          = 0x7fc00000
+	userNotifContinue     = 1
+
+	ioctlNotifRecv    = 0xc0502100 // SECCOMP_IOWR(0, struct seccomp_notif)
+	ioctlNotifSend    = 0xc0182101 // SECCOMP_IOWR(1, struct seccomp_notif_resp)
+	ioctlNotifIDValid = 0x40082102 // SECCOMP_IOW(2, __u64)
+)
+
+// notif is struct seccomp_notif
+type notif struct {
+	id    uint64
+	pid   uint32
+	flags uint32
+	nr    int32
+	arch  uint32
+	ip    uint64
+	args  [6]uint64
+}
+
+// notifResp is struct seccomp_notif_resp
+type notifResp struct {
+	id    uint64
+	val   int64
+	error int32
+	flags uint32
+}
+
+var (
+	namesOnce sync.Once
+	names     map[uintptr]string
+)
+
+// name returns the name of the system call with number nr.
+func name(nr uintptr) string {
+	namesOnce.Do(func() {
+		names = make(map[uintptr]string, len(numbers))
+		for n, number := range numbers {
+			names[number] = n
+		}
+	})
+	return names[nr]
+}
+
+// Allows returns whether the policy allows the named system call with args.
+func (p Policy) Allows(name string, args [6]uint64) bool {
+	conds, exists := p[name]
+	if !exists {
+		return false
+	}
+	if len(conds) == 0 {
+		return true
+	}
+	for _, c := range conds {
+		if args[c.Arg]&c.Mask == c.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify compiles a seccomp-BPF program for the architecture of the running
+// process, which defers the named system calls to a listener, and allows every
+// other system call.
+func Notify(list []string) ([]unix.SockFilter, error) {
+	if auditArch == 0 {
+		return nil, errors.New("seccomp filters not supported on this architecture")
+	}
+
+	prog := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, auditArch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, retKillProcess),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNR),
+	}
+
+	sorted := append([]string(nil), list...)
+	sort.Strings(sorted)
+	for _, n := range sorted {
+		nr, exists := numbers[n]
+		if !exists {
+			continue
+		}
+		prog = append(prog,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, retUserNotif),
+		)
+	}
+
+	return append(prog, stmt(unix.BPF_RET|unix.BPF_K, retAllow)), nil
+}
+
+// InstallNotify installs a seccomp filter for the calling thread, and any
+// process it executes, which defers the named system calls to a listener. The
+// file descriptor of the listener is returned, and is inherited by any process
+// the calling thread executes unless closed.
+func InstallNotify(list []string) (int, error) {
+	prog, err := Notify(list)
+	if err != nil {
+		return -1, err
+	}
+	fd, err := install(prog, filterFlagNewListener)
+	if err != nil {
+		return -1, fmt.Errorf("failed to install seccomp listener: %w", err)
+	}
+	return fd, nil
+}
+
+// Reporting compiles the policy into a seccomp-BPF program like Program, except
+// that the system calls the policy does not allow are deferred to a listener,
+// along with the named system calls, so that violations can be reported.
+func (p Policy) Reporting(deferred []string) ([]unix.SockFilter, error) {
+	return p.program(deferred, retUserNotif)
+}
+
+// InstallReporting installs the policy as a seccomp filter for the calling
+// thread like Install, deferring the named system calls and those the policy
+// does not allow to a listener. The file descriptor of the listener is
+// returned, and is inherited by any process the calling thread executes
+// unless closed.
+func (p Policy) InstallReporting(deferred []string) (int, error) {
+	prog, err := p.Reporting(deferred)
+	if err != nil {
+		return -1, err
+	}
+	fd, err := install(prog, filterFlagNewListener)
+	if err != nil {
+		return -1, fmt.Errorf("failed to install seccomp filter: %w", err)
+	}
+	return fd, nil
+}
+
+// Notification is a system call of a filtered process, which is blocked until
+// the listener responds.
+type Notification struct {
+	ID   uint64
+	PID  int // thread id of the caller, in the pid namespace of the listener
+	Nr   int // number of the system call
+	Name string
+	Args [6]uint64
+}
+
+// Listener receives the system calls deferred by a seccomp filter.
+type Listener struct {
+	fd int
+}
+
+// NewListener returns a Listener for the seccomp listener file descriptor fd.
+func NewListener(fd int) *Listener {
+	return &Listener{fd: fd}
+}
+
+// Receive blocks until a filtered process makes a deferred system call.
+func (l *Listener) Receive() (*Notification, error) {
+	for {
+		var n notif
+		errno := l.ioctl(ioctlNotifRecv, unsafe.Pointer(&n))
+		switch errno {
+		case 0:
+			return &Notification{
+				ID:   n.id,
+				PID:  int(n.pid),
+				Nr:   int(n.nr),
+				Name: name(uintptr(n.nr)),
+				Args: n.args,
+			}, nil
+		case unix.EINTR, unix.ENOENT:
+			// interrupted, or the caller died before it was received
+			continue
+		default:
+			return nil, fmt.Errorf("failed to receive seccomp notification: %w", errno)
+		}
+	}
+}
+
+// Valid returns whether the notification with id is still pending, meaning the
+// process that made the system call is still alive and waiting.
+func (l *Listener) Valid(id uint64) bool {
+	return l.ioctl(ioctlNotifIDValid, unsafe.Pointer(&id)) == 0
+}
+
+// Continue lets the system call of the notification with id proceed.
+func (l *Listener) Continue(id uint64) error {
+	return l.send(&notifResp{id: id, flags: userNotifContinue})
+}
+
+// Deny fails the system call of the notification with id with errno.
+func (l *Listener) Deny(id uint64, errno unix.Errno) error {
+	return l.send(&notifResp{id: id, error: -int32(errno)})
+}
+
+// Close the listener, after which every deferred system call fails.
+func (l *Listener) Close() error {
+	return unix.Close(l.fd)
+}
+
+func (l *Listener) send(resp *notifResp) error {
+	switch errno := l.ioctl(ioctlNotifSend, unsafe.Pointer(resp)); errno {
+	case 0, unix.ENOENT:
+		// the caller may have died in the meantime
+		return nil
+	default:
+		return fmt.Errorf("failed to respond to seccomp notification: %w", errno)
+	}
+}
+
+func (l *Listener) ioctl(request uintptr, arg unsafe.Pointer) unix.Errno {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(l.fd), request, uintptr(arg))
+	return errno
+}
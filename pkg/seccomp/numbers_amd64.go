@@ -0,0 +1,199 @@
+package seccomp
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+const auditArch = unix.AUDIT_ARCH_X86_64
+
+// abiMask is the lowest system call number of the x32 abi, which shares the
+// audit architecture of x86_64
+const abiMask = 0x40000000
+
+// numbers maps the names of system calls to their numbers
+var numbers = map[string]uintptr{
+	"accept":                 unix.SYS_ACCEPT,
+	"accept4":                unix.SYS_ACCEPT4,
+	"access":                 unix.SYS_ACCESS,
+	"alarm":                  unix.SYS_ALARM,
+	"arch_prctl":             unix.SYS_ARCH_PRCTL,
+	"bind":                   unix.SYS_BIND,
+	"brk":                    unix.SYS_BRK,
+	"chdir":                  unix.SYS_CHDIR,
+	"chmod":                  unix.SYS_CHMOD,
+	"clock_getres":           unix.SYS_CLOCK_GETRES,
+	"clock_gettime":          unix.SYS_CLOCK_GETTIME,
+	"clock_nanosleep":        unix.SYS_CLOCK_NANOSLEEP,
+	"clone":                  unix.SYS_CLONE,
+	"clone3":                 unix.SYS_CLONE3,
+	"close":                  unix.SYS_CLOSE,
+	"close_range":            unix.SYS_CLOSE_RANGE,
+	"connect":                unix.SYS_CONNECT,
+	"creat":                  unix.SYS_CREAT,
+	"dup":                    unix.SYS_DUP,
+	"dup2":                   unix.SYS_DUP2,
+	"dup3":                   unix.SYS_DUP3,
+	"epoll_create":           unix.SYS_EPOLL_CREATE,
+	"epoll_create1":          unix.SYS_EPOLL_CREATE1,
+	"epoll_ctl":              unix.SYS_EPOLL_CTL,
+	"epoll_pwait":            unix.SYS_EPOLL_PWAIT,
+	"epoll_pwait2":           unix.SYS_EPOLL_PWAIT2,
+	"epoll_wait":             unix.SYS_EPOLL_WAIT,
+	"eventfd":                unix.SYS_EVENTFD,
+	"eventfd2":               unix.SYS_EVENTFD2,
+	"execve":                 unix.SYS_EXECVE,
+	"execveat":               unix.SYS_EXECVEAT,
+	"exit":                   unix.SYS_EXIT,
+	"exit_group":             unix.SYS_EXIT_GROUP,
+	"faccessat":              unix.SYS_FACCESSAT,
+	"faccessat2":             unix.SYS_FACCESSAT2,
+	"fchdir":                 unix.SYS_FCHDIR,
+	"fchmod":                 unix.SYS_FCHMOD,
+	"fchmodat":               unix.SYS_FCHMODAT,
+	"fchown":                 unix.SYS_FCHOWN,
+	"fchownat":               unix.SYS_FCHOWNAT,
+	"fcntl":                  unix.SYS_FCNTL,
+	"fdatasync":              unix.SYS_FDATASYNC,
+	"fork":                   unix.SYS_FORK,
+	"fstat":                  unix.SYS_FSTAT,
+	"fstatfs":                unix.SYS_FSTATFS,
+	"fsync":                  unix.SYS_FSYNC,
+	"ftruncate":              unix.SYS_FTRUNCATE,
+	"futex":                  unix.SYS_FUTEX,
+	"futimesat":              unix.SYS_FUTIMESAT,
+	"get_robust_list":        unix.SYS_GET_ROBUST_LIST,
+	"getcpu":                 unix.SYS_GETCPU,
+	"getcwd":                 unix.SYS_GETCWD,
+	"getdents":               unix.SYS_GETDENTS,
+	"getdents64":             unix.SYS_GETDENTS64,
+	"getegid":                unix.SYS_GETEGID,
+	"geteuid":                unix.SYS_GETEUID,
+	"getgid":                 unix.SYS_GETGID,
+	"getgroups":              unix.SYS_GETGROUPS,
+	"getitimer":              unix.SYS_GETITIMER,
+	"getpeername":            unix.SYS_GETPEERNAME,
+	"getpgid":                unix.SYS_GETPGID,
+	"getpgrp":                unix.SYS_GETPGRP,
+	"getpid":                 unix.SYS_GETPID,
+	"getppid":                unix.SYS_GETPPID,
+	"getpriority":            unix.SYS_GETPRIORITY,
+	"getrandom":              unix.SYS_GETRANDOM,
+	"getresgid":              unix.SYS_GETRESGID,
+	"getresuid":              unix.SYS_GETRESUID,
+	"getrlimit":              unix.SYS_GETRLIMIT,
+	"getsid":                 unix.SYS_GETSID,
+	"getsockname":            unix.SYS_GETSOCKNAME,
+	"getsockopt":             unix.SYS_GETSOCKOPT,
+	"gettid":                 unix.SYS_GETTID,
+	"gettimeofday":           unix.SYS_GETTIMEOFDAY,
+	"getuid":                 unix.SYS_GETUID,
+	"ioctl":                  unix.SYS_IOCTL,
+	"kill":                   unix.SYS_KILL,
+	"lchown":                 unix.SYS_LCHOWN,
+	"link":                   unix.SYS_LINK,
+	"linkat":                 unix.SYS_LINKAT,
+	"listen":                 unix.SYS_LISTEN,
+	"lseek":                  unix.SYS_LSEEK,
+	"lstat":                  unix.SYS_LSTAT,
+	"madvise":                unix.SYS_MADVISE,
+	"mkdir":                  unix.SYS_MKDIR,
+	"mkdirat":                unix.SYS_MKDIRAT,
+	"mknod":                  unix.SYS_MKNOD,
+	"mknodat":                unix.SYS_MKNODAT,
+	"mmap":                   unix.SYS_MMAP,
+	"mprotect":               unix.SYS_MPROTECT,
+	"mremap":                 unix.SYS_MREMAP,
+	"msync":                  unix.SYS_MSYNC,
+	"munmap":                 unix.SYS_MUNMAP,
+	"nanosleep":              unix.SYS_NANOSLEEP,
+	"newfstatat":             unix.SYS_NEWFSTATAT,
+	"open":                   unix.SYS_OPEN,
+	"openat":                 unix.SYS_OPENAT,
+	"pause":                  unix.SYS_PAUSE,
+	"pipe":                   unix.SYS_PIPE,
+	"pipe2":                  unix.SYS_PIPE2,
+	"poll":                   unix.SYS_POLL,
+	"ppoll":                  unix.SYS_PPOLL,
+	"pread64":                unix.SYS_PREAD64,
+	"preadv":                 unix.SYS_PREADV,
+	"preadv2":                unix.SYS_PREADV2,
+	"prlimit64":              unix.SYS_PRLIMIT64,
+	"pselect6":               unix.SYS_PSELECT6,
+	"pwrite64":               unix.SYS_PWRITE64,
+	"pwritev":                unix.SYS_PWRITEV,
+	"pwritev2":               unix.SYS_PWRITEV2,
+	"read":                   unix.SYS_READ,
+	"readlink":               unix.SYS_READLINK,
+	"readlinkat":             unix.SYS_READLINKAT,
+	"readv":                  unix.SYS_READV,
+	"recvfrom":               unix.SYS_RECVFROM,
+	"recvmsg":                unix.SYS_RECVMSG,
+	"rename":                 unix.SYS_RENAME,
+	"renameat":               unix.SYS_RENAMEAT,
+	"renameat2":              unix.SYS_RENAMEAT2,
+	"restart_syscall":        unix.SYS_RESTART_SYSCALL,
+	"rmdir":                  unix.SYS_RMDIR,
+	"rseq":                   unix.SYS_RSEQ,
+	"rt_sigaction":           unix.SYS_RT_SIGACTION,
+	"rt_sigprocmask":         unix.SYS_RT_SIGPROCMASK,
+	"rt_sigreturn":           unix.SYS_RT_SIGRETURN,
+	"rt_sigsuspend":          unix.SYS_RT_SIGSUSPEND,
+	"rt_sigtimedwait":        unix.SYS_RT_SIGTIMEDWAIT,
+	"sched_get_priority_max": unix.SYS_SCHED_GET_PRIORITY_MAX,
+	"sched_get_priority_min": unix.SYS_SCHED_GET_PRIORITY_MIN,
+	"sched_getaffinity":      unix.SYS_SCHED_GETAFFINITY,
+	"sched_getparam":         unix.SYS_SCHED_GETPARAM,
+	"sched_getscheduler":     unix.SYS_SCHED_GETSCHEDULER,
+	"sched_setaffinity":      unix.SYS_SCHED_SETAFFINITY,
+	"sched_setparam":         unix.SYS_SCHED_SETPARAM,
+	"sched_setscheduler":     unix.SYS_SCHED_SETSCHEDULER,
+	"sched_yield":            unix.SYS_SCHED_YIELD,
+	"select":                 unix.SYS_SELECT,
+	"sendmsg":                unix.SYS_SENDMSG,
+	"sendto":                 unix.SYS_SENDTO,
+	"set_robust_list":        unix.SYS_SET_ROBUST_LIST,
+	"set_tid_address":        unix.SYS_SET_TID_ADDRESS,
+	"setfsgid":               unix.SYS_SETFSGID,
+	"setfsuid":               unix.SYS_SETFSUID,
+	"setgid":                 unix.SYS_SETGID,
+	"setgroups":              unix.SYS_SETGROUPS,
+	"setitimer":              unix.SYS_SETITIMER,
+	"setpgid":                unix.SYS_SETPGID,
+	"setpriority":            unix.SYS_SETPRIORITY,
+	"setregid":               unix.SYS_SETREGID,
+	"setresgid":              unix.SYS_SETRESGID,
+	"setresuid":              unix.SYS_SETRESUID,
+	"setreuid":               unix.SYS_SETREUID,
+	"setrlimit":              unix.SYS_SETRLIMIT,
+	"setsid":                 unix.SYS_SETSID,
+	"setsockopt":             unix.SYS_SETSOCKOPT,
+	"setuid":                 unix.SYS_SETUID,
+	"shutdown":               unix.SYS_SHUTDOWN,
+	"sigaltstack":            unix.SYS_SIGALTSTACK,
+	"socket":                 unix.SYS_SOCKET,
+	"socketpair":             unix.SYS_SOCKETPAIR,
+	"stat":                   unix.SYS_STAT,
+	"statfs":                 unix.SYS_STATFS,
+	"statx":                  unix.SYS_STATX,
+	"symlink":                unix.SYS_SYMLINK,
+	"symlinkat":              unix.SYS_SYMLINKAT,
+	"sysinfo":                unix.SYS_SYSINFO,
+	"tgkill":                 unix.SYS_TGKILL,
+	"timerfd_create":         unix.SYS_TIMERFD_CREATE,
+	"timerfd_gettime":        unix.SYS_TIMERFD_GETTIME,
+	"timerfd_settime":        unix.SYS_TIMERFD_SETTIME,
+	"tkill":                  unix.SYS_TKILL,
+	"truncate":               unix.SYS_TRUNCATE,
+	"umask":                  unix.SYS_UMASK,
+	"uname":                  unix.SYS_UNAME,
+	"unlink":                 unix.SYS_UNLINK,
+	"unlinkat":               unix.SYS_UNLINKAT,
+	"utime":                  unix.SYS_UTIME,
+	"utimensat":              unix.SYS_UTIMENSAT,
+	"utimes":                 unix.SYS_UTIMES,
+	"vfork":                  unix.SYS_VFORK,
+	"wait4":                  unix.SYS_WAIT4,
+	"waitid":                 unix.SYS_WAITID,
+	"write":                  unix.SYS_WRITE,
+	"writev":                 unix.SYS_WRITEV,
+}
@@ -0,0 +1,11 @@
+//go:build !amd64 && !arm64
+
+package seccomp
+
+// auditArch is zero, because seccomp filters are not supported on this
+// architecture
+const auditArch = 0
+
+const abiMask = 0
+
+var numbers = map[string]uintptr{}
@@ -0,0 +1,245 @@
+// Package seccomp compiles an allow-list of system calls into a seccomp-BPF
+// filter, and installs the filter for the calling thread.
+package seccomp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// from linux/seccomp.h
+const (
+	setModeFilter = 1
+
+	retKillProcess = 0x80000000
+	retErrno       = 0x00050000
+	retAllow       = 0x7fff0000
+)
+
+// offsets into struct seccomp_data
+const (
+	offsetNR   = 0
+	offsetArch = 4
+	offsetArgs = 16
+)
+
+// Cond restricts a system call to invocations where the argument at index Arg
+// masked with Mask equals Value.
+type Cond struct {
+	Arg   int
+	Mask  uint64
+	Value uint64
+}
+
+// fallbacks are system calls whose arguments a filter cannot inspect, because
+// they are passed in memory. Unless the policy allows them, they fail with
+// ENOSYS rather than EPERM, so that callers fall back to system calls whose
+// arguments can be inspected, e.g. clone3 to clone.
+var fallbacks = []string{"clone3"}
+
+// Policy maps the name of each allowed system call to the conditions under
+// which it is allowed, any one of which must hold. A system call present
+// without conditions is always allowed. Every other system call fails with
+// EPERM, except for the fallbacks, which fail with ENOSYS.
+type Policy map[string][]Cond
+
+// Allow the named system call, under any one of conds if given. Allowing a
+// system call without conditions overrides any conditions.
+func (p Policy) Allow(name string, conds ...Cond) {
+	existing, exists := p[name]
+	switch {
+	case exists && len(existing) == 0:
+		return // already always allowed
+	case len(conds) == 0:
+		p[name] = nil
+	default:
+		p[name] = append(existing, conds...)
+	}
+}
+
+// Merge every system call allowed by other into p.
+func (p Policy) Merge(other Policy) {
+	for name, conds := range other {
+		p.Allow(name, conds...)
+	}
+}
+
+// Program compiles the policy into a seccomp-BPF program for the architecture
+// of the running process. System calls that do not exist on the architecture
+// are ignored.
+func (p Policy) Program() ([]unix.SockFilter, error) {
+	return p.program(nil, retErrno|uint32(unix.EPERM))
+}
+
+// program compiles the policy into a seccomp-BPF program, which defers the
+// named system calls to a listener, and returns denied for system calls the
+// policy does not allow.
+func (p Policy) program(deferred []string, denied uint32) ([]unix.SockFilter, error) {
+	if auditArch == 0 {
+		return nil, errors.New("seccomp filters not supported on this architecture")
+	}
+
+	// verify the architecture, so system call numbers mean what we think
+	prog := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, auditArch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, retKillProcess),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNR),
+	}
+
+	// reject system calls of any alternative abi, e.g. x32
+	if abiMask != 0 {
+		prog = append(prog,
+			jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, abiMask, 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, denied),
+		)
+	}
+
+	// deferred system calls come first, regardless of the policy
+	sorted := append([]string(nil), deferred...)
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		nr, exists := numbers[name]
+		if !exists {
+			continue
+		}
+		prog = append(prog,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, retUserNotif),
+		)
+	}
+
+	for _, name := range fallbacks {
+		nr, exists := numbers[name]
+		if _, allowed := p[name]; !exists || allowed {
+			continue
+		}
+		prog = append(prog,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, retErrno|uint32(unix.ENOSYS)),
+		)
+	}
+
+	// sorted for a deterministic program
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		nr, exists := numbers[name]
+		if !exists {
+			continue
+		}
+		block := conditions(p[name], denied)
+		if len(block) > 255 {
+			return nil, fmt.Errorf("too many conditions for system call %q", name)
+		}
+		prog = append(prog, jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), 0, uint8(len(block))))
+		prog = append(prog, block...)
+	}
+
+	return append(prog, stmt(unix.BPF_RET|unix.BPF_K, denied)), nil
+}
+
+// conditions compiles the block of a system call, which allows the system call
+// if any of conds holds, and denies it otherwise. The accumulator is clobbered
+// only by blocks that always return.
+func conditions(conds []Cond, denied uint32) []unix.SockFilter {
+	if len(conds) == 0 {
+		return []unix.SockFilter{stmt(unix.BPF_RET|unix.BPF_K, retAllow)}
+	}
+
+	var block []unix.SockFilter
+	for _, c := range conds {
+		var check []unix.SockFilter
+
+		// compare the low 32 bits, then the high 32 bits if masked
+		words := []struct {
+			offset      uint32
+			mask, value uint32
+		}{
+			{uint32(offsetArgs + 8*c.Arg), uint32(c.Mask), uint32(c.Value)},
+		}
+		if c.Mask>>32 != 0 {
+			words = append(words, struct {
+				offset      uint32
+				mask, value uint32
+			}{uint32(offsetArgs + 8*c.Arg + 4), uint32(c.Mask >> 32), uint32(c.Value >> 32)})
+		}
+
+		// each word check skips to the next condition on mismatch, which
+		// is just past the final allow of this condition
+		for i, w := range words {
+			remaining := uint8(3*(len(words)-i-1) + 1)
+			check = append(check,
+				stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, w.offset),
+				stmt(unix.BPF_ALU|unix.BPF_AND|unix.BPF_K, w.mask),
+				jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, w.value, 0, remaining),
+			)
+		}
+		check = append(check, stmt(unix.BPF_RET|unix.BPF_K, retAllow))
+		block = append(block, check...)
+	}
+	return append(block, stmt(unix.BPF_RET|unix.BPF_K, denied))
+}
+
+func stmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+func jump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+// Supported returns whether the running kernel supports seccomp filters on
+// this architecture.
+func Supported() bool {
+	if auditArch == 0 {
+		return false
+	}
+	_, err := os.Stat("/proc/sys/kernel/seccomp/actions_avail")
+	return err == nil
+}
+
+// Install the policy as a seccomp filter for the calling thread, and any
+// process it executes. Other threads of the process are not filtered, so the
+// calling thread should be locked and exec soon after. The calling thread must
+// have no_new_privs set, or CAP_SYS_ADMIN.
+func (p Policy) Install() error {
+	prog, err := p.Program()
+	if err != nil {
+		return err
+	}
+	if _, err = install(prog, 0); err != nil {
+		return fmt.Errorf("failed to install seccomp filter: %w", err)
+	}
+	return nil
+}
+
+// install the seccomp-BPF program with flags for the calling thread.
+func install(prog []unix.SockFilter, flags uintptr) (int, error) {
+	fprog := unix.SockFprog{
+		Len:    uint16(len(prog)),
+		Filter: &prog[0],
+	}
+
+	// a raw system call, so the runtime does not use any system calls the
+	// filter may deny on the way back from installing it
+	result, _, errno := unix.RawSyscall(
+		unix.SYS_SECCOMP,
+		setModeFilter,
+		flags,
+		uintptr(unsafe.Pointer(&fprog)),
+	)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(result), nil
+}
@@ -0,0 +1,141 @@
+package seccomp
+
+import (
+	"testing"
+
+	"github.com/shoenig/test/must"
+	"golang.org/x/sys/unix"
+)
+
+func TestPolicy_Allow(t *testing.T) {
+	p := make(Policy)
+	c := Cond{Arg: 1, Mask: 0xff, Value: 1}
+
+	p.Allow("ioctl", c)
+	must.Eq(t, []Cond{c}, p["ioctl"])
+
+	// allowing without conditions overrides the conditions
+	p.Allow("ioctl")
+	must.Nil(t, p["ioctl"])
+
+	// and conditions are not added back
+	p.Allow("ioctl", c)
+	must.Nil(t, p["ioctl"])
+}
+
+func TestPolicy_Merge(t *testing.T) {
+	c := Cond{Arg: 0, Mask: 0xff, Value: 2}
+	p := Policy{"read": nil, "socket": []Cond{c}}
+	p.Merge(Policy{"write": nil, "socket": []Cond{{Arg: 0, Mask: 0xff, Value: 10}}})
+	must.MapContainsKeys(t, p, []string{"read", "write", "socket"})
+	must.SliceLen(t, 2, p["socket"])
+}
+
+func TestPolicy_Program(t *testing.T) {
+	if auditArch == 0 {
+		t.Skip("seccomp filters not supported on this architecture")
+	}
+
+	p := Policy{"read": nil, "no_such_syscall": nil}
+	prog, err := p.Program()
+	must.NoError(t, err)
+
+	// starts by checking the architecture
+	must.Eq(t, stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch), prog[0])
+	must.Eq(t, uint32(auditArch), prog[1].K)
+
+	// unknown system calls are ignored, and the rest are denied
+	read := jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(numbers["read"]), 0, 1)
+	must.SliceContains(t, prog, read)
+	must.Eq(t, stmt(unix.BPF_RET|unix.BPF_K, retErrno|uint32(unix.EPERM)), prog[len(prog)-1])
+}
+
+func TestPolicy_Program_fallbacks(t *testing.T) {
+	if auditArch == 0 {
+		t.Skip("seccomp filters not supported on this architecture")
+	}
+
+	clone3 := jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(numbers["clone3"]), 0, 1)
+	enosys := stmt(unix.BPF_RET|unix.BPF_K, retErrno|uint32(unix.ENOSYS))
+
+	// clone3 fails with ENOSYS, so callers fall back to clone
+	prog, err := Policy{"clone": nil}.Program()
+	must.NoError(t, err)
+	must.SliceContains(t, prog, clone3)
+	must.SliceContains(t, prog, enosys)
+
+	// unless the policy allows it
+	prog, err = Policy{"clone3": nil}.Program()
+	must.NoError(t, err)
+	must.SliceNotContains(t, prog, enosys)
+}
+
+func TestPolicy_conditions(t *testing.T) {
+	denied := uint32(retErrno | uint32(unix.EPERM))
+
+	// a 32 bit condition checks only the low word
+	block := conditions([]Cond{{Arg: 1, Mask: 0xff, Value: 3}}, denied)
+	must.SliceLen(t, 5, block)
+	must.Eq(t, uint32(offsetArgs+8), block[0].K)
+	must.Eq(t, uint8(1), block[2].Jf)
+	must.Eq(t, uint32(retAllow), block[3].K)
+	must.Eq(t, denied, block[4].K)
+
+	// a 64 bit condition also checks the high word
+	block = conditions([]Cond{{Arg: 2, Mask: ^uint64(0), Value: 0}}, denied)
+	must.SliceLen(t, 8, block)
+	must.Eq(t, uint8(4), block[2].Jf)
+	must.Eq(t, uint32(offsetArgs+16+4), block[3].K)
+	must.Eq(t, uint8(1), block[5].Jf)
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	p := Policy{
+		"read":   nil,
+		"socket": []Cond{{Arg: 0, Mask: 0xff, Value: 2}, {Arg: 0, Mask: 0xff, Value: 10}},
+	}
+	must.True(t, p.Allows("read", [6]uint64{}))
+	must.True(t, p.Allows("socket", [6]uint64{10}))
+	must.False(t, p.Allows("socket", [6]uint64{1}))
+	must.False(t, p.Allows("write", [6]uint64{}))
+}
+
+func TestNotify(t *testing.T) {
+	if auditArch == 0 {
+		t.Skip("seccomp filters not supported on this architecture")
+	}
+
+	prog, err := Notify([]string{"execve", "no_such_syscall"})
+	must.NoError(t, err)
+	must.SliceLen(t, 7, prog)
+	must.Eq(t, uint32(numbers["execve"]), prog[4].K)
+	must.Eq(t, uint32(retUserNotif), prog[5].K)
+	must.Eq(t, uint32(retAllow), prog[6].K)
+	must.Eq(t, "execve", name(numbers["execve"]))
+}
+
+func TestPolicy_Reporting(t *testing.T) {
+	if auditArch == 0 {
+		t.Skip("seccomp filters not supported on this architecture")
+	}
+
+	p := Policy{"read": nil}
+	prog, err := p.Reporting([]string{"execve"})
+	must.NoError(t, err)
+
+	// deferred system calls come before the fallbacks and the policy, ahead
+	// of the final deny
+	i := len(prog) - 7
+	must.Eq(t, uint32(numbers["execve"]), prog[i].K)
+	must.Eq(t, uint32(retUserNotif), prog[i+1].K)
+	must.Eq(t, uint32(numbers["clone3"]), prog[i+2].K)
+	must.Eq(t, uint32(retErrno|uint32(unix.ENOSYS)), prog[i+3].K)
+	must.Eq(t, uint32(numbers["read"]), prog[i+4].K)
+	must.Eq(t, uint32(retAllow), prog[i+5].K)
+
+	// denied system calls are deferred too
+	must.Eq(t, uint32(retUserNotif), prog[len(prog)-1].K)
+	for _, f := range prog {
+		must.NotEq(t, uint32(retErrno|uint32(unix.EPERM)), f.K)
+	}
+}
@@ -0,0 +1,175 @@
+// Package shim implements the supervisor process of a task.
+//
+// The supervisor is the plugin executable re-invoked with the Command argument,
+// one per task. It starts the task in the task cgroup, reports the task pid to
+// the plugin, reaps the task, and durably records the exit status of the task
+// before exiting. The task inherits the log handles of the supervisor, so logs
+// keep flowing and exit codes are never lost while the plugin is restarting.
+package shim
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/shoenig/nomad-pledge/pkg/resources/process"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Command is the argument that makes the plugin executable run as the
+	// supervisor of a task.
+	Command = "shim"
+
+	// reportFD is the file descriptor over which the supervisor reports
+	// the pid of the task, or the error of starting the task.
+	reportFD = 3
+)
+
+// Config is the configuration of a supervisor.
+type Config struct {
+	Exit   string   // file the exit status of the task is recorded into
+	Cgroup string   // cgroup the task is cloned into (optional)
+	Args   []string // command of the task
+}
+
+// Arguments returns the arguments for running the supervisor with config,
+// excluding the executable.
+func Arguments(config *Config) []string {
+	args := []string{Command, "-exit", config.Exit}
+	if config.Cgroup != "" {
+		args = append(args, "-cgroup", config.Cgroup)
+	}
+	args = append(args, "--")
+	return append(args, config.Args...)
+}
+
+// Is returns whether pid is a supervisor recording the exit status of its task
+// into exit. The executable is not compared, as the plugin may have been
+// moved since starting the supervisor.
+func Is(pid int, exit string) bool {
+	args := process.Cmdline(pid)
+	if len(args) < 2 || args[1] != Command {
+		return false
+	}
+	config, err := Parse(args[2:])
+	return err == nil && config.Exit == exit
+}
+
+// Parse the arguments of the supervisor, excluding the executable and Command.
+func Parse(args []string) (*Config, error) {
+	config := new(Config)
+	flags := flag.NewFlagSet(Command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&config.Exit, "exit", "", "exit status file")
+	flags.StringVar(&config.Cgroup, "cgroup", "", "task cgroup")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	config.Args = flags.Args()
+	switch {
+	case config.Exit == "":
+		return nil, errors.New("exit status file must be set")
+	case len(config.Args) == 0:
+		return nil, errors.New("command must be set")
+	}
+	return config, nil
+}
+
+// Run the supervisor with the given arguments, excluding the executable and
+// Command, returning the exit code of the supervisor.
+func Run(args []string) int {
+	// the task must not inherit the report, or the plugin would block
+	// reading it until the task exits
+	unix.CloseOnExec(reportFD)
+	report := os.NewFile(reportFD, "report")
+
+	// the supervisor lives on its own, and is not interrupted alongside the
+	// plugin; the task is stopped through its cgroup instead
+	signal.Ignore(syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGPIPE)
+
+	config, err := Parse(args)
+	if err != nil {
+		_, _ = fmt.Fprintf(report, "error %v\n", err)
+		return 1
+	}
+
+	if err = Supervise(config, report); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pledge shim: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// Supervise starts the task, reports its pid to report, then waits on the task
+// and records its exit status. Errors starting the task are also reported to
+// report, which is closed once the task has started.
+func Supervise(config *Config, report io.WriteCloser) error {
+	// a stale exit status from a previous run of the task must not be
+	// mistaken for the exit status of this run
+	if err := os.Remove(config.Exit); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return failed(report, fmt.Errorf("failed to remove stale exit status: %w", err))
+	}
+
+	cmd := exec.Command(config.Args[0], config.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true, // signals are sent to the process group
+	}
+
+	if config.Cgroup != "" {
+		fd, err := unix.Open(config.Cgroup, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return failed(report, fmt.Errorf("failed to open cgroup: %w", err))
+		}
+		cmd.SysProcAttr.UseCgroupFD = true // clone directly into cgroup
+		cmd.SysProcAttr.CgroupFD = fd
+		defer func() { _ = unix.Close(fd) }()
+	}
+
+	if err := cmd.Start(); err != nil {
+		return failed(report, fmt.Errorf("failed to start command: %w", err))
+	}
+
+	_, _ = fmt.Fprintf(report, "pid %d\n", cmd.Process.Pid)
+	_ = report.Close()
+
+	exit := process.WaitOnChild(cmd.Process).Wait()
+	return process.WriteExit(config.Exit, exit)
+}
+
+func failed(report io.WriteCloser, err error) error {
+	_, _ = fmt.Fprintf(report, "error %v\n", err)
+	_ = report.Close()
+	return err
+}
+
+// ReadReport reads the report of a supervisor, returning the pid of the task
+// or the error of starting the task.
+func ReadReport(r io.Reader) (int, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read supervisor report: %w", err)
+	}
+	kind, value, _ := strings.Cut(strings.TrimSpace(string(b)), " ")
+	switch kind {
+	case "pid":
+		pid, pErr := strconv.Atoi(value)
+		if pErr != nil {
+			return 0, fmt.Errorf("failed to parse supervisor report: %w", pErr)
+		}
+		return pid, nil
+	case "error":
+		return 0, errors.New(value)
+	default:
+		return 0, errors.New("supervisor exited without reporting")
+	}
+}
@@ -0,0 +1,124 @@
+package shim
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shoenig/nomad-pledge/pkg/resources/process"
+	"github.com/shoenig/test/must"
+	"github.com/shoenig/test/wait"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("SHIM_TEST_SLEEP") == "1" {
+		time.Sleep(10 * time.Second)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestShim_Arguments(t *testing.T) {
+	config := &Config{
+		Exit:   "/tmp/pledge.exit",
+		Cgroup: "/sys/fs/cgroup/nomad.slice/task.scope",
+		Args:   []string{"unshare", "-f", "--", "echo", "-exit"},
+	}
+	args := Arguments(config)
+	must.Eq(t, Command, args[0])
+
+	result, err := Parse(args[1:])
+	must.NoError(t, err)
+	must.Eq(t, config, result)
+}
+
+func TestShim_Parse_invalid(t *testing.T) {
+	_, err := Parse([]string{"--", "echo"})
+	must.ErrorContains(t, err, "exit status file must be set")
+
+	_, err = Parse([]string{"-exit", "/tmp/pledge.exit"})
+	must.ErrorContains(t, err, "command must be set")
+}
+
+func TestShim_ReadReport(t *testing.T) {
+	pid, err := ReadReport(strings.NewReader("pid 1234\n"))
+	must.NoError(t, err)
+	must.Eq(t, 1234, pid)
+
+	_, err = ReadReport(strings.NewReader("error failed to start command\n"))
+	must.EqError(t, err, "failed to start command")
+
+	_, err = ReadReport(strings.NewReader(""))
+	must.EqError(t, err, "supervisor exited without reporting")
+}
+
+func TestShim_Supervise(t *testing.T) {
+	exit := filepath.Join(t.TempDir(), "pledge.exit")
+	must.NoError(t, os.WriteFile(exit, []byte("stale"), 0o644))
+
+	r, w, err := os.Pipe()
+	must.NoError(t, err)
+	defer func() { _ = r.Close() }()
+
+	config := &Config{
+		Exit: exit,
+		Args: []string{"sh", "-c", "exit 3"},
+	}
+	must.NoError(t, Supervise(config, w))
+
+	pid, err := ReadReport(r)
+	must.NoError(t, err)
+	must.Positive(t, pid)
+
+	result, err := process.ReadExit(exit)
+	must.NoError(t, err)
+	must.Eq(t, 3, result.Code)
+}
+
+func TestShim_Supervise_failure(t *testing.T) {
+	exit := filepath.Join(t.TempDir(), "pledge.exit")
+
+	r, w, err := os.Pipe()
+	must.NoError(t, err)
+	defer func() { _ = r.Close() }()
+
+	config := &Config{
+		Exit: exit,
+		Args: []string{"/does/not/exist"},
+	}
+	must.Error(t, Supervise(config, w))
+
+	_, err = ReadReport(r)
+	must.ErrorContains(t, err, "failed to start command")
+
+	_, err = os.Stat(exit)
+	must.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestShim_Is(t *testing.T) {
+	exit := filepath.Join(t.TempDir(), "exit")
+
+	// a process with the command line of the supervisor
+	cmd := exec.Command(os.Args[0])
+	cmd.Args = append([]string{"nomad-pledge-driver"}, Arguments(&Config{Exit: exit, Args: []string{"sleep"}})...)
+	cmd.Env = append(os.Environ(), "SHIM_TEST_SLEEP=1")
+	must.NoError(t, cmd.Start())
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	pid := cmd.Process.Pid
+	must.Wait(t, wait.InitialSuccess(
+		wait.BoolFunc(func() bool { return Is(pid, exit) }),
+		wait.Timeout(5*time.Second),
+		wait.Gap(10*time.Millisecond),
+	))
+
+	// supervising another task, or not a supervisor at all
+	must.False(t, Is(pid, exit+".other"))
+	must.False(t, Is(os.Getpid(), exit))
+}
@@ -2,6 +2,7 @@ package task
 
 import (
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,33 +23,57 @@ type Handle struct {
 	result    *drivers.ExitResult
 	clock     libtime.Clock
 
-	pid int
+	pid    int
+	frozen bool
+
+	// rendering of the sandbox, which does not change once started
+	rendering *pledge.Rendering
+	renderErr error
+
+	// serializes changes of the frozen state, which wait for the cgroup
+	// without holding lock
+	freezing sync.Mutex
 }
 
+const (
+	// Freeze is the pseudo-signal for freezing every process of a task.
+	Freeze = "freeze"
+
+	// Thaw is the pseudo-signal for thawing every process of a task.
+	Thaw = "thaw"
+)
+
 func NewHandle(runner pledge.Exec, config *drivers.TaskConfig) (*Handle, time.Time) {
 	clock := libtime.SystemClock()
 	now := clock.Now()
+	rendering, renderErr := runner.Render()
 	return &Handle{
-		pid:     runner.PID(),
-		runner:  runner,
-		config:  config,
-		state:   drivers.TaskStateRunning,
-		clock:   clock,
-		started: now,
-		result:  new(drivers.ExitResult),
+		pid:       runner.PID(),
+		runner:    runner,
+		config:    config,
+		state:     drivers.TaskStateRunning,
+		clock:     clock,
+		started:   now,
+		result:    new(drivers.ExitResult),
+		rendering: rendering,
+		renderErr: renderErr,
 	}, now
 }
 
 func RecreateHandle(runner pledge.Exec, config *drivers.TaskConfig, started time.Time) *Handle {
 	clock := libtime.SystemClock()
+	rendering, renderErr := runner.Render()
 	return &Handle{
-		pid:     runner.PID(),
-		runner:  runner,
-		config:  config,
-		state:   drivers.TaskStateUnknown,
-		clock:   clock,
-		started: started,
-		result:  new(drivers.ExitResult),
+		pid:       runner.PID(),
+		runner:    runner,
+		config:    config,
+		state:     drivers.TaskStateUnknown,
+		clock:     clock,
+		started:   started,
+		result:    new(drivers.ExitResult),
+		frozen:    runner.Frozen(),
+		rendering: rendering,
+		renderErr: renderErr,
 	}
 }
 
@@ -58,6 +83,20 @@ func (h *Handle) Stats() resources.Utilization {
 	return h.runner.Stats()
 }
 
+func (h *Handle) Environment() map[string]string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.runner.Environment()
+}
+
+// Render returns how the task is sandboxed, as rendered when the handle was
+// created.
+func (h *Handle) Render() (*pledge.Rendering, error) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.rendering, h.renderErr
+}
+
 func (h *Handle) Status() *drivers.TaskStatus {
 	h.lock.RLock()
 	defer h.lock.RUnlock()
@@ -70,11 +109,18 @@ func (h *Handle) Status() *drivers.TaskStatus {
 		CompletedAt: h.completed,
 		ExitResult:  h.result,
 		DriverAttributes: map[string]string{
-			"pid": strconv.Itoa(h.pid),
+			"pid":    strconv.Itoa(h.pid),
+			"frozen": strconv.FormatBool(h.frozen),
 		},
 	}
 }
 
+func (h *Handle) Config() *drivers.TaskConfig {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.config
+}
+
 func (h *Handle) IsRunning() bool {
 	h.lock.RLock()
 	defer h.lock.RUnlock()
@@ -99,10 +145,61 @@ func (h *Handle) Block() {
 	h.state = drivers.TaskStateExited
 }
 
+// Signal the task, where the Freeze and Thaw pseudo-signals freeze and thaw
+// the whole task cgroup.
 func (h *Handle) Signal(s string) error {
-	return h.runner.Signal(s)
+	switch strings.ToLower(s) {
+	case Freeze:
+		return h.setFrozen(true)
+	case Thaw:
+		return h.setFrozen(false)
+	default:
+		return h.runner.Signal(s)
+	}
+}
+
+func (h *Handle) setFrozen(frozen bool) error {
+	h.freezing.Lock()
+	defer h.freezing.Unlock()
+
+	var err error
+	switch frozen {
+	case true:
+		err = h.runner.Freeze()
+	case false:
+		err = h.runner.Thaw()
+	}
+
+	// the cgroup may be left in the requested state even if waiting for it
+	// failed
+	if err != nil {
+		frozen = h.runner.Frozen()
+	}
+
+	h.lock.Lock()
+	h.frozen = frozen
+	h.lock.Unlock()
+	return err
+}
+
+func (h *Handle) IsFrozen() bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.frozen
 }
 
 func (h *Handle) Stop(signal string, timeout time.Duration) error {
+	// a frozen task cannot react to signals, so thaw it first
+	if h.IsFrozen() {
+		_ = h.setFrozen(false)
+	}
 	return h.runner.Stop(signal, timeout)
 }
+
+func (h *Handle) Kill(signal string, timeout time.Duration) error {
+	// a frozen task cannot react to signals, so thaw it first
+	if h.IsFrozen() {
+		_ = h.setFrozen(false)
+	}
+	return h.runner.Kill(signal, timeout)
+}
@@ -0,0 +1,78 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/shoenig/nomad-pledge/pkg/pledge"
+	"github.com/shoenig/test/must"
+)
+
+// fakeExec is a pledge.Exec whose cgroup takes a while to freeze.
+type fakeExec struct {
+	pledge.Exec
+
+	frozen  bool
+	renders int
+	waiting chan struct{}
+	release chan struct{}
+}
+
+func (f *fakeExec) PID() int { return 1234 }
+
+func (f *fakeExec) Frozen() bool { return f.frozen }
+
+func (f *fakeExec) Render() (*pledge.Rendering, error) {
+	f.renders++
+	return &pledge.Rendering{Args: []string{"sh"}}, nil
+}
+
+func (f *fakeExec) Freeze() error {
+	f.frozen = true
+	close(f.waiting)
+	<-f.release
+	return nil
+}
+
+func TestHandle_setFrozen(t *testing.T) {
+	runner := &fakeExec{waiting: make(chan struct{}), release: make(chan struct{})}
+	h, _ := NewHandle(runner, new(drivers.TaskConfig))
+
+	done := make(chan error)
+	go func() { done <- h.setFrozen(true) }()
+
+	// the handle can be read while waiting for the cgroup to freeze
+	<-runner.waiting
+	must.False(t, h.IsFrozen())
+
+	close(runner.release)
+	select {
+	case err := <-done:
+		must.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for freeze")
+	}
+	must.True(t, h.IsFrozen())
+}
+
+func TestHandle_RecreateHandle_frozen(t *testing.T) {
+	h := RecreateHandle(&fakeExec{frozen: true}, new(drivers.TaskConfig), time.Now())
+	must.True(t, h.IsFrozen())
+
+	h = RecreateHandle(&fakeExec{}, new(drivers.TaskConfig), time.Now())
+	must.False(t, h.IsFrozen())
+}
+
+func TestHandle_Render(t *testing.T) {
+	runner := new(fakeExec)
+	h, _ := NewHandle(runner, new(drivers.TaskConfig))
+
+	// rendered once, when the handle is created
+	for i := 0; i < 3; i++ {
+		r, err := h.Render()
+		must.NoError(t, err)
+		must.Eq(t, []string{"sh"}, r.Args)
+	}
+	must.Eq(t, 1, runner.renders)
+}
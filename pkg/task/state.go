@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/shoenig/nomad-pledge/pkg/pledge"
 )
 
 // State is the runtime state encoded in the handle, returned
@@ -14,4 +15,25 @@ type State struct {
 	StartedAt  time.Time
 
 	PID int
+
+	// ShimPID is the pid of the supervisor of the task, if any
+	ShimPID int
+
+	// UserNS is the id mapping of the task user namespace, if any
+	UserNS *pledge.IDMap
+
+	// DynamicUser is the uid and gid of the task dynamic user, if any
+	DynamicUser uint32
+
+	// Options the task was started with, so that recovering the task does
+	// not depend on the current plugin configuration
+	Options *pledge.Options
+
+	// Holder is the host pid of the holder of the namespaces the task shares
+	// with its allocation, if any
+	Holder int
+
+	// Exit is the file the supervisor of the task records its exit status
+	// into, if any
+	Exit string
 }
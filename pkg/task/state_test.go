@@ -0,0 +1,34 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/shoenig/nomad-pledge/pkg/pledge"
+	"github.com/shoenig/nomad-pledge/pkg/resources"
+	"github.com/shoenig/test/must"
+)
+
+func TestState_options(t *testing.T) {
+	opts := &pledge.Options{
+		Command:    "server",
+		Arguments:  []string{"-port", "8080"},
+		Promises:   "stdio inet",
+		Unveil:     []string{"r:/etc"},
+		Importance: &resources.Importance{Label: "low", Nice: 10, IOWeight: 50, Policy: resources.PolicyBatch},
+		CapAdd:     []string{"net_bind_service"},
+		EnvPolicies: []*pledge.EnvPolicy{
+			{Deny: []string{"AWS_*"}},
+		},
+		StopSteps: []pledge.Step{{Signal: "SIGINT", Timeout: 5 * time.Second}},
+	}
+
+	handle := drivers.NewTaskHandle(1)
+	must.NoError(t, handle.SetDriverState(&State{PID: 100, Options: opts}))
+
+	var state State
+	must.NoError(t, handle.GetDriverState(&state))
+	must.Eq(t, 100, state.PID)
+	must.Eq(t, opts, state.Options)
+}